@@ -26,6 +26,7 @@ import (
 	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
 	"os"
@@ -101,8 +102,21 @@ func main() {
 		os.Exit(1)
 	}
 
+	distros, err := controllers.NewDistroRegistry(ctrlConfig.Distros)
+	if err != nil {
+		setupLog.Error(err, "invalid distros")
+		os.Exit(1)
+	}
+
+	shells, err := controllers.NewShellRegistry(ctrlConfig.Shells)
+	if err != nil {
+		setupLog.Error(err, "invalid shells")
+		os.Exit(1)
+	}
+
 	if len(ctrlConfig.DefaultDistro) > 0 {
-		if controllers.ValidateDistro(appcorev1.CliAppDistro(ctrlConfig.DefaultDistro)) != nil {
+		err = controllers.ValidateDistro(distros, appcorev1.CliAppDistro(ctrlConfig.DefaultDistro))
+		if err != nil {
 			setupLog.Error(err, "invalid distro")
 			os.Exit(1)
 		}
@@ -112,7 +126,8 @@ func main() {
 	}
 
 	if len(ctrlConfig.DefaultShell) > 0 {
-		if controllers.ValidateShell(appcorev1.CliAppShell(ctrlConfig.DefaultShell)) != nil {
+		err = controllers.ValidateShell(shells, appcorev1.CliAppShell(ctrlConfig.DefaultShell))
+		if err != nil {
 			setupLog.Error(err, "invalid shell")
 			os.Exit(1)
 		}
@@ -121,6 +136,57 @@ func main() {
 		ctrlConfig.DefaultShell = string(appcorev1.CliAppShellBash)
 	}
 
+	if len(ctrlConfig.DefaultSecurityProfile) > 0 {
+		err = controllers.ValidateSecurityProfile(appcorev1.CliAppSecurityProfile(ctrlConfig.DefaultSecurityProfile))
+		if err != nil {
+			setupLog.Error(err, "invalid security profile")
+			os.Exit(1)
+		}
+	}
+
+	userHome, err := controllers.NewUserHomeConfig(ctrlConfig.UserHome)
+	if err != nil {
+		setupLog.Error(err, "invalid user home")
+		os.Exit(1)
+	}
+
+	if ctrlConfig.MaxRetries <= 0 {
+		ctrlConfig.MaxRetries = controllers.DefaultMaxRetries
+	}
+
+	if ctrlConfig.RetryBackoff.Duration <= 0 {
+		ctrlConfig.RetryBackoff.Duration = controllers.DefaultRetryBackoff
+	}
+
+	if ctrlConfig.UnschedulableGracePeriod.Duration <= 0 {
+		ctrlConfig.UnschedulableGracePeriod.Duration = controllers.DefaultUnschedulableGrace
+	}
+
+	if ctrlConfig.RolloutGracePeriod.Duration <= 0 {
+		ctrlConfig.RolloutGracePeriod.Duration = controllers.DefaultRolloutGrace
+	}
+
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+
+	rootfsProviders, err := controllers.DetectRootfsProviders(context.TODO(), clientset)
+	if err != nil {
+		setupLog.Error(err, "unable to detect rootfs providers")
+		os.Exit(1)
+	}
+
+	rootfsProvider, err := controllers.DefaultRootfsProvider(rootfsProviders,
+		appcorev1.CliAppRootfsProvider(ctrlConfig.RootfsProvider))
+	if err != nil {
+		setupLog.Error(err, "invalid rootfs provider")
+		os.Exit(1)
+	}
+
+	setupLog.Info("rootfs providers", "available", rootfsProviders, "default", rootfsProvider)
+
 	criConn, err := newCRIConnection(setupLog, criEndpoint, time.Minute)
 	if err != nil {
 		os.Exit(1)
@@ -129,18 +195,35 @@ func main() {
 	defer criConn.Close()
 
 	if err = (&controllers.CliAppReconciler{
-		CRIImage:               cri.NewImageServiceClient(criConn),
-		RestClient:             clientGetter(mgr),
-		Client:                 mgr.GetClient(),
-		Log:                    ctrl.Log.WithName("controllers").WithName("CliApp"),
-		Scheme:                 mgr.GetScheme(),
-		DurationIdleLiveLasts:  ctrlConfig.DurationIdleLivesLast.Duration,
-		BuilderEndpoint:        ctrlConfig.BuilderService,
-		ControllerNamespace:    utils.GetCurrentNamespace(),
-		ImageBuilder:           controllers.InitImageBuilderOrDie(ctrlConfig.BuilderService),
-		DefaultAppContextImage: ctrlConfig.DefaultAppContextImage,
-		DefaultDistro:          appcorev1.CliAppDistro(ctrlConfig.DefaultDistro),
-		DefaultShell:           appcorev1.CliAppShell(ctrlConfig.DefaultShell),
+		CRIImage:                 cri.NewImageServiceClient(criConn),
+		ImageResolver:            controllers.NewImageConfigResolver(ctrlConfig.InsecureRegistries),
+		RestClient:               clientGetter(mgr),
+		Client:                   mgr.GetClient(),
+		Log:                      ctrl.Log.WithName("controllers").WithName("CliApp"),
+		Scheme:                   mgr.GetScheme(),
+		Recorder:                 mgr.GetEventRecorderFor("cliapp-controller"),
+		DurationIdleLiveLasts:    ctrlConfig.DurationIdleLivesLast.Duration,
+		MaxRetries:               ctrlConfig.MaxRetries,
+		RetryBackoff:             ctrlConfig.RetryBackoff.Duration,
+		RolloutGracePeriod:       ctrlConfig.RolloutGracePeriod.Duration,
+		UnschedulableGracePeriod: ctrlConfig.UnschedulableGracePeriod.Duration,
+		BuilderEndpoint:          ctrlConfig.BuilderService,
+		ControllerNamespace:      utils.GetCurrentNamespace(),
+		ImageBuilder:             controllers.InitImageBuilderOrDie(ctrlConfig.BuilderService),
+		DefaultAppContextImage:   ctrlConfig.DefaultAppContextImage,
+		DefaultDistro:            appcorev1.CliAppDistro(ctrlConfig.DefaultDistro),
+		DefaultShell:             appcorev1.CliAppShell(ctrlConfig.DefaultShell),
+		Distros:                  distros,
+		Shells:                   shells,
+		DefaultResources:         ctrlConfig.DefaultResources,
+		MaxResources:             ctrlConfig.MaxResources,
+		NativeToolsImage:         ctrlConfig.NativeToolsImage,
+		DefaultSecurityProfile:   appcorev1.CliAppSecurityProfile(ctrlConfig.DefaultSecurityProfile),
+		DefaultRootfsProvider:    rootfsProvider,
+		RootfsProviders:          rootfsProviders,
+		RegistryMirrors:          ctrlConfig.RegistryMirrors,
+		ImagePrefixRewrites:      ctrlConfig.ImagePrefixRewrites,
+		UserHome:                 userHome,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CliApp")
 		os.Exit(1)
@@ -6,12 +6,19 @@ import (
 	"flag"
 	"github.com/warm-metal/cliapp/pkg/gate"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	_ "google.golang.org/grpc/grpclog"
 	"k8s.io/klog/v2"
 	"net"
+	"time"
 )
 
 var addr = flag.String("addr", ":8001", "TCP address to listen on")
+var startupTimeout = flag.Duration("startup-timeout", 5*time.Minute,
+	"The longest duration to wait for an app to be ready. Sessions would be closed after the timeout.")
+var tlsCert = flag.String("tls-cert", "",
+	"The TLS certificate file of the gate. User tokens are only accepted over TLS.")
+var tlsKey = flag.String("tls-key", "", "The private key file of the TLS certificate.")
 
 func init() {
 	klog.InitFlags(flag.CommandLine)
@@ -21,8 +28,18 @@ func main() {
 	flag.Parse()
 	klog.LogToStderr(true)
 	defer klog.Flush()
-	s := grpc.NewServer()
-	gate.PrepareGate(s)
+	var opts []grpc.ServerOption
+	if len(*tlsCert) > 0 || len(*tlsKey) > 0 {
+		creds, err := credentials.NewServerTLSFromFile(*tlsCert, *tlsKey)
+		if err != nil {
+			panic(err)
+		}
+
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	s := grpc.NewServer(opts...)
+	gate.PrepareGate(s, *startupTimeout)
 
 	l, err := net.Listen("tcp", *addr)
 	if err != nil {
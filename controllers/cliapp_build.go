@@ -45,6 +45,7 @@ type imageBuilderContext struct {
 	client     *buildkit.Client
 	Name       string
 	Dockerfile string
+	BuildArgs  map[string]string
 	Image      string
 	Stdout     bytes.Buffer
 	Error      error
@@ -95,8 +96,26 @@ func (b *imageBuilderContext) start() {
 		return
 	}
 
+	for k, v := range b.BuildArgs {
+		solveOpt.FrontendAttrs["build-arg:"+k] = v
+	}
+
+	// Logs of the build are collected to Stdout. The channel is closed by Solve.
+	statusCh := make(chan *buildkit.SolveStatus)
+	logDone := make(chan struct{})
+	go func() {
+		defer close(logDone)
+		for status := range statusCh {
+			for _, entry := range status.Logs {
+				b.Stdout.Write(entry.Data)
+			}
+		}
+	}()
+
 	b.log.Info("build image", "opts", solveOpt)
-	if _, err = b.client.Solve(b.ctx, nil, solveOpt, nil); err != nil {
+	_, err = b.client.Solve(b.ctx, nil, solveOpt, statusCh)
+	<-logDone
+	if err != nil {
 		b.finish(xerrors.Errorf("%s", err))
 		return
 	}
@@ -106,9 +125,25 @@ func (b *imageBuilderContext) start() {
 
 var underBuild = xerrors.Errorf("image is under build")
 
-func (b *ImageBuilder) testImage(log logr.Logger, app *appcorev1.CliApp) (image string, err error) {
-	if ctx, found := b.appMap[app.Name]; found && ctx.Done {
-		return ctx.Image, ctx.Error
+// The image built for an app. It could be rewritten by rules of the controller.
+const builtImage = "docker.io/warmmetal/%s:v1"
+
+// testImage starts building the image from the Dockerfile if not started yet. It returns underBuild until done,
+// and the output of the build.
+func (b *ImageBuilder) testImage(
+	log logr.Logger, app *appcorev1.CliApp, image, dockerfile string, buildArgs map[string]string,
+) (string, string, error) {
+	if ctx, found := b.appMap[app.Name]; found {
+		if ctx.Image == image && ctx.Dockerfile == dockerfile {
+			if ctx.Done {
+				return ctx.Image, ctx.Stdout.String(), ctx.Error
+			}
+
+			return ctx.Image, "", underBuild
+		}
+
+		// The image to be built is changed.
+		ctx.fallback()
 	}
 
 	remoteCtx, cancel := context.WithCancel(context.TODO())
@@ -118,14 +153,15 @@ func (b *ImageBuilder) testImage(log logr.Logger, app *appcorev1.CliApp) (image
 		ctx:        remoteCtx,
 		cancel:     cancel,
 		Name:       app.Name,
-		Image:      fmt.Sprintf("docker.io/warmmetal/%s:v1", app.Name),
-		Dockerfile: app.Spec.Dockerfile,
+		Image:      image,
+		Dockerfile: dockerfile,
+		BuildArgs:  buildArgs,
 		Error:      underBuild,
 	}
 
 	b.appMap[app.Name] = ctx
 	go ctx.start()
-	return ctx.Image, ctx.Error
+	return ctx.Image, "", ctx.Error
 }
 
 func (b *ImageBuilder) cancel(app *appcorev1.CliApp) {
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var aliasPattern = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]*$`)
+
+const (
+	defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+	// reason of the failure that the app command is not found in the app image.
+	commandNotFoundReason = "CommandNotFound"
+
+	// the output of the probe which prefixes the event message if the probe fails
+	commandNotFoundOutput = "command not found:"
+)
+
+// shellQuote quotes a string as a single word of the POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// commandCandidates returns paths under the root where Spec.Command[0] could be found.
+// The session gate runs the command via "chroot /app-root", or directly in the Native mode, so a command
+// without slashes is looked up in PATH of the image as well as the default PATH.
+func commandCandidates(command, workingDir, imagePath, root string) []string {
+	if strings.Contains(command, "/") {
+		if !filepath.IsAbs(command) {
+			command = filepath.Join("/", workingDir, command)
+		}
+
+		return []string{filepath.Join(root, command)}
+	}
+
+	dirs := strings.Split(defaultPath, ":")
+	if len(imagePath) > 0 {
+		dirs = append(strings.Split(imagePath, ":"), dirs...)
+	}
+
+	found := make(map[string]bool, len(dirs))
+	candidates := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if len(dir) == 0 {
+			continue
+		}
+
+		candidate := filepath.Join(root, dir, command)
+		if found[candidate] {
+			continue
+		}
+
+		found[candidate] = true
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates
+}
+
+// commandProbe generates a startup probe of the workspace container which checks whether the app command
+// exists in the app image. The Pod won't be ready until the probe succeeds.
+// Symbolic links are accepted without being resolved since they may point to paths in the image.
+// Directories of tool images in toolPaths are also looked up, since the gate appends them to PATH of the image.
+func commandProbe(spec *appcorev1.CliAppSpec, config *imageConfiguration, toolPaths []string) *corev1.Probe {
+	command := spec.Command
+	if len(command) == 0 && spec.UseImageEntrypoint {
+		// The image cmd is not checked since it could be replaced by arguments from the client.
+		command = config.Entrypoint
+	}
+
+	var commands []string
+	if len(command) > 0 && len(command[0]) > 0 {
+		commands = append(commands, command[0])
+	}
+
+	for _, alias := range commandAliases(spec) {
+		commands = append(commands, spec.Commands[alias][0])
+	}
+
+	if len(commands) == 0 {
+		return nil
+	}
+
+	// The app image is the rootfs of the workspace container in the Native mode,
+	// which may have no shell but busybox copied by the controller.
+	root, sh := appRoot, []string{"sh"}
+	if isNativeMode(spec) {
+		root, sh = "/", []string{nativeBusybox, "sh"}
+	}
+
+	checks := make([]string, 0, len(commands))
+	for _, command := range commands {
+		candidates := commandCandidates(command, config.WorkingDir,
+			strings.Join(append([]string{config.Path}, toolPaths...), ":"), root)
+
+		quoted := make([]string, len(candidates))
+		for i := range candidates {
+			quoted[i] = shellQuote(candidates[i])
+		}
+
+		checks = append(checks, fmt.Sprintf(
+			`found=; for f in %s; do if [ -L "$f" ] || { [ -f "$f" ] && [ -x "$f" ]; }; then found=1; break; fi; `+
+				`done; [ -n "$found" ] || { echo %s; exit 1; }`,
+			strings.Join(quoted, " "),
+			shellQuote(fmt.Sprintf("%s %s", commandNotFoundOutput, command)),
+		))
+	}
+
+	script := strings.Join(checks, "; ")
+
+	return &corev1.Probe{
+		Handler: corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: append(sh, "-c", script),
+			},
+		},
+		PeriodSeconds:    2,
+		FailureThreshold: 1,
+	}
+}
+
+// commandAliases returns aliases of Spec.Commands in order.
+func commandAliases(spec *appcorev1.CliAppSpec) []string {
+	aliases := make([]string, 0, len(spec.Commands))
+	for alias := range spec.Commands {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+	return aliases
+}
+
+// validateCommands checks aliases and commands of Spec.Commands. Aliases are used as file names of shortcuts.
+func validateCommands(spec *appcorev1.CliAppSpec) error {
+	for alias, command := range spec.Commands {
+		if !aliasPattern.MatchString(alias) {
+			return xerrors.Errorf("alias %q must consist of alphanumeric characters, '-', '_' or '.'", alias)
+		}
+
+		if len(command) == 0 || len(command[0]) == 0 {
+			return xerrors.Errorf("command of alias %q is empty", alias)
+		}
+	}
+
+	return nil
+}
+
+func hasCommandProbe(pod *corev1.Pod) bool {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == appContainer {
+			return pod.Spec.Containers[i].StartupProbe != nil
+		}
+	}
+
+	return false
+}
+
+// commandNotFound checks whether the event is reported by a failed command probe.
+// It returns a message which describes the missing command.
+func commandNotFound(ev *corev1.Event) (message string, found bool) {
+	if ev.Reason != "Unhealthy" {
+		return
+	}
+
+	i := strings.Index(ev.Message, commandNotFoundOutput)
+	if i < 0 {
+		return
+	}
+
+	command := strings.TrimSpace(ev.Message[i+len(commandNotFoundOutput):])
+	return fmt.Sprintf("command %q is not found or not executable in the app image", command), true
+}
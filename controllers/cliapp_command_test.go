@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	corev1 "k8s.io/api/core/v1"
+	"os/exec"
+)
+
+var _ = Describe("CliApp command", func() {
+	It("should look up commands in PATH of the image", func() {
+		Expect(commandCandidates("kubectl", "", "/opt/bin:/usr/bin", appRoot)).To(Equal([]string{
+			"/app-root/opt/bin/kubectl",
+			"/app-root/usr/bin/kubectl",
+			"/app-root/usr/local/sbin/kubectl",
+			"/app-root/usr/local/bin/kubectl",
+			"/app-root/usr/sbin/kubectl",
+			"/app-root/sbin/kubectl",
+			"/app-root/bin/kubectl",
+		}))
+		Expect(commandCandidates("/usr/bin/kubectl", "/work", "", appRoot)).To(Equal([]string{"/app-root/usr/bin/kubectl"}))
+		Expect(commandCandidates("./run.sh", "/work", "", appRoot)).To(Equal([]string{"/app-root/work/run.sh"}))
+	})
+
+	It("should probe commands only if set", func() {
+		Expect(commandProbe(&appcorev1.CliAppSpec{}, &imageConfiguration{}, nil)).To(BeNil())
+	})
+
+	It("should report the missing command", func() {
+		probe := commandProbe(&appcorev1.CliAppSpec{Command: []string{"it's-missing"}}, &imageConfiguration{}, nil)
+		Expect(probe).NotTo(BeNil())
+		output, err := exec.Command(probe.Exec.Command[0], probe.Exec.Command[1:]...).Output()
+		Expect(err).To(HaveOccurred())
+
+		message, found := commandNotFound(&corev1.Event{
+			Reason:  "Unhealthy",
+			Message: "Startup probe failed: " + string(output),
+		})
+		Expect(found).To(BeTrue())
+		Expect(message).To(ContainSubstring(`"it's-missing"`))
+
+		_, found = commandNotFound(&corev1.Event{Reason: "Unhealthy", Message: "Readiness probe failed: "})
+		Expect(found).To(BeFalse())
+	})
+
+	It("should report the missing command of aliases", func() {
+		probe := commandProbe(&appcorev1.CliAppSpec{
+			Commands: map[string][]string{"b": {"missing-alias-command"}},
+		}, &imageConfiguration{}, nil)
+		Expect(probe).NotTo(BeNil())
+		output, err := exec.Command(probe.Exec.Command[0], probe.Exec.Command[1:]...).Output()
+		Expect(err).To(HaveOccurred())
+		Expect(string(output)).To(ContainSubstring("missing-alias-command"))
+	})
+
+	It("should validate aliases", func() {
+		Expect(validateCommands(&appcorev1.CliAppSpec{Commands: map[string][]string{"kubectl-1.21": {"kubectl"}}})).
+			To(Succeed())
+		Expect(validateCommands(&appcorev1.CliAppSpec{Commands: map[string][]string{"a/b": {"kubectl"}}})).
+			NotTo(Succeed())
+		Expect(validateCommands(&appcorev1.CliAppSpec{Commands: map[string][]string{"k": {}}})).NotTo(Succeed())
+		Expect(commandAliases(&appcorev1.CliAppSpec{Commands: map[string][]string{"b": {"b"}, "a": {"a"}}})).
+			To(Equal([]string{"a", "b"}))
+	})
+})
@@ -8,12 +8,18 @@ import (
 	"github.com/warm-metal/cliapp/pkg/utils"
 	"golang.org/x/xerrors"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"time"
 )
 
 var (
 	DefaultRequeueDuration = 5 * time.Second
+	DefaultMaxRetries      = int32(5)
+	DefaultRetryBackoff    = 10 * time.Second
+	DefaultRolloutGrace    = time.Hour
+	// Long enough for the cluster autoscaler to add nodes.
+	DefaultUnschedulableGrace = 5 * time.Minute
 )
 
 func groupPods(podList *corev1.PodList) (
@@ -41,9 +47,55 @@ func groupPods(podList *corev1.PodList) (
 	return
 }
 
+func setCondition(
+	app *appcorev1.CliApp, conditionType string, status metav1.ConditionStatus, reason, message string,
+) {
+	meta.SetStatusCondition(&app.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: app.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setPodConditions updates conditions PodScheduled and Ready of the app according to its Pod.
+func setPodConditions(app *appcorev1.CliApp, pod *corev1.Pod) {
+	if pod == nil {
+		setCondition(app, appcorev1.CliAppConditionPodScheduled, metav1.ConditionFalse, "PodNotCreated", "")
+		setCondition(app, appcorev1.CliAppConditionReady, metav1.ConditionFalse, "PodNotCreated", "")
+		return
+	}
+
+	_, scheduled := utils.GetPodCondition(&pod.Status, corev1.PodScheduled)
+	if scheduled != nil && scheduled.Status == corev1.ConditionTrue {
+		setCondition(app, appcorev1.CliAppConditionPodScheduled, metav1.ConditionTrue, "Scheduled",
+			fmt.Sprintf("Pod %s is scheduled to node %s", pod.Name, pod.Spec.NodeName))
+	} else if scheduled != nil && len(scheduled.Reason) > 0 {
+		setCondition(app, appcorev1.CliAppConditionPodScheduled, metav1.ConditionFalse, scheduled.Reason,
+			scheduled.Message)
+	} else {
+		setCondition(app, appcorev1.CliAppConditionPodScheduled, metav1.ConditionFalse, "Pending",
+			fmt.Sprintf("Pod %s is pending", pod.Name))
+	}
+
+	if utils.IsPodReady(pod) {
+		setCondition(app, appcorev1.CliAppConditionReady, metav1.ConditionTrue, "PodReady",
+			fmt.Sprintf("Pod %s is ready", pod.Name))
+	} else {
+		setCondition(app, appcorev1.CliAppConditionReady, metav1.ConditionFalse, "PodNotReady",
+			fmt.Sprintf("Pod %s is not ready", pod.Name))
+	}
+}
+
 func (r *CliAppReconciler) transitPhaseTo(
 	ctx context.Context, log logr.Logger, app *appcorev1.CliApp, phase appcorev1.CliAppPhase,
 ) error {
+	if app.Status.Phase != phase {
+		r.Recorder.Eventf(app, corev1.EventTypeNormal, string(phase), "app transits from %q to %q",
+			app.Status.Phase, phase)
+	}
+
 	app.Status.Phase = phase
 	app.Status.LastPhaseTransition = metav1.Now()
 
@@ -58,6 +110,9 @@ func (r *CliAppReconciler) transitPhaseTo(
 
 	if phase == appcorev1.CliAppPhaseRest {
 		app.Status.PodName = ""
+		app.Status.RetiringPods = nil
+		setCondition(app, appcorev1.CliAppConditionPodScheduled, metav1.ConditionFalse, "Rest", "app is at rest")
+		setCondition(app, appcorev1.CliAppConditionReady, metav1.ConditionFalse, "Rest", "app is at rest")
 	}
 
 	if err := r.Status().Update(ctx, app); err != nil {
@@ -68,9 +123,10 @@ func (r *CliAppReconciler) transitPhaseTo(
 	return nil
 }
 
-func validateApp(app *appcorev1.CliApp) error {
-	if len(app.Spec.Image) == 0 && len(app.Spec.Dockerfile) == 0 && app.Spec.Fork == nil {
-		return xerrors.Errorf("specify either image, dockerfile, or Fork for the app")
+func (r *CliAppReconciler) validateApp(app *appcorev1.CliApp) error {
+	if len(app.Spec.Image) == 0 && len(app.Spec.Dockerfile) == 0 && len(app.Spec.Packages) == 0 &&
+		app.Spec.Fork == nil {
+		return xerrors.Errorf("specify either image, dockerfile, packages, or Fork for the app")
 	}
 
 	if app.Spec.TargetPhase == "" {
@@ -82,37 +138,82 @@ func validateApp(app *appcorev1.CliApp) error {
 	}
 
 	if len(app.Spec.Distro) > 0 {
-		if err := ValidateDistro(app.Spec.Distro); err != nil {
+		if err := ValidateDistro(r.distros(), app.Spec.Distro); err != nil {
 			return err
 		}
 
 	}
 
 	if len(app.Spec.Shell) > 0 {
-		if err := ValidateShell(app.Spec.Shell); err != nil {
+		if err := ValidateShell(r.shells(), app.Spec.Shell); err != nil {
 			return err
 		}
 	}
 
-	return nil
-}
+	if len(app.Spec.ExecutionMode) > 0 {
+		if err := ValidateExecutionMode(app.Spec.ExecutionMode); err != nil {
+			return err
+		}
+	}
 
-func ValidateDistro(d appcorev1.CliAppDistro) error {
-	switch d {
-	case appcorev1.CliAppDistroAlpine, appcorev1.CliAppDistroUbuntu:
-		return nil
-	default:
-		return xerrors.Errorf("Spec.Distro must be either %q or %q",
-			appcorev1.CliAppDistroAlpine, appcorev1.CliAppDistroUbuntu)
+	if len(app.Spec.SecurityProfile) > 0 {
+		if err := ValidateSecurityProfile(app.Spec.SecurityProfile); err != nil {
+			return err
+		}
+	}
+
+	if len(app.Spec.RootfsProvider) > 0 {
+		if err := ValidateRootfsProvider(app.Spec.RootfsProvider); err != nil {
+			return err
+		}
+	}
+
+	if err := validatePackages(app); err != nil {
+		return err
+	}
+
+	if err := r.validateUserHomes(&app.Spec); err != nil {
+		return err
+	}
+
+	if err := validateShellRC(&app.Spec); err != nil {
+		return err
 	}
-}
 
-func ValidateShell(s appcorev1.CliAppShell) error {
-	switch s {
-	case appcorev1.CliAppShellZsh, appcorev1.CliAppShellBash:
-		return nil
-	default:
-		return xerrors.Errorf("Spec.Shell must be either %q or %q",
-			appcorev1.CliAppShellZsh, appcorev1.CliAppShellBash)
+	if err := validateCommands(&app.Spec); err != nil {
+		return err
+	}
+
+	if err := validateToolImages(&app.Spec); err != nil {
+		return err
+	}
+
+	if len(app.Spec.ToolImages) > 0 {
+		if err := r.checkRootfsMounts(&app.Spec, "toolImages"); err != nil {
+			return err
+		}
+	}
+
+	if _, err := parseEnvs(&app.Spec); err != nil {
+		return err
 	}
+
+	if _, _, err := parseVolumes(&app.Spec); err != nil {
+		return err
+	}
+
+	if err := validatePodTemplate(&app.Spec); err != nil {
+		return err
+	}
+
+	if err := validateKeepAlive(&app.Spec); err != nil {
+		return err
+	}
+
+	resources := mergeResources(r.DefaultResources, app.Spec.Resources)
+	if err := validateResources(&resources, r.MaxResources); err != nil {
+		return err
+	}
+
+	return nil
 }
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	configv1 "github.com/warm-metal/cliapp/pkg/apis/config/v1"
+	"golang.org/x/xerrors"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// placeholder in context images of distros which is replaced with the shell name.
+	contextImageShellPlaceholder = "{shell}"
+
+	packageManagerApk    = "apk"
+	packageManagerApt    = "apt"
+	packageManagerDnf    = "dnf"
+	packageManagerPacman = "pacman"
+)
+
+var (
+	// Distros apps could work on if the controller doesn't configure.
+	BuiltinDistros = map[appcorev1.CliAppDistro]configv1.CliAppDistroContext{
+		appcorev1.CliAppDistroAlpine: {
+			ContextImage:   "docker.io/warmmetal/app-context-{shell}-alpine:latest",
+			BaseImage:      "docker.io/library/alpine:latest",
+			PackageManager: packageManagerApk,
+		},
+		appcorev1.CliAppDistroUbuntu: {
+			ContextImage:   "docker.io/warmmetal/app-context-{shell}-ubuntu:latest",
+			BaseImage:      "docker.io/library/ubuntu:latest",
+			PackageManager: packageManagerApt,
+			ChrootUserspec: true,
+		},
+		appcorev1.CliAppDistroDebian: {
+			ContextImage:   "docker.io/warmmetal/app-context-{shell}-debian:latest",
+			BaseImage:      "docker.io/library/debian:stable-slim",
+			PackageManager: packageManagerApt,
+			ChrootUserspec: true,
+		},
+		appcorev1.CliAppDistroFedora: {
+			ContextImage:   "docker.io/warmmetal/app-context-{shell}-fedora:latest",
+			BaseImage:      "docker.io/library/fedora:latest",
+			PackageManager: packageManagerDnf,
+			ChrootUserspec: true,
+		},
+		appcorev1.CliAppDistroArch: {
+			ContextImage:   "docker.io/warmmetal/app-context-{shell}-arch:latest",
+			BaseImage:      "docker.io/library/archlinux:latest",
+			PackageManager: packageManagerPacman,
+			ChrootUserspec: true,
+		},
+	}
+
+	// Shells apps could use if the controller doesn't configure.
+	BuiltinShells = map[appcorev1.CliAppShell]configv1.CliAppShellContext{
+		appcorev1.CliAppShellBash: {
+			RCFile:       ".bash_profile",
+			HistoryEnv:   "HISTFILE",
+			LoginCommand: []string{"bash", "-l"},
+		},
+		appcorev1.CliAppShellZsh: {
+			RCFile:       ".zshrc",
+			HistoryEnv:   "HISTFILE",
+			LoginCommand: []string{"zsh", "-l"},
+		},
+		// fish keeps its history in its own format under its data directory, which no variable could point to
+		// a file of the session gate, so no history is kept.
+		appcorev1.CliAppShellFish: {
+			RCFile:        ".config/fish/config.fish",
+			LoginCommand:  []string{"fish", "-l"},
+			SourceCommand: "source",
+		},
+		appcorev1.CliAppShellSh: {
+			RCFile:       ".profile",
+			HistoryEnv:   "HISTFILE",
+			LoginCommand: []string{"sh", "-l"},
+		},
+	}
+
+	packageManagers = []string{packageManagerApk, packageManagerApt, packageManagerDnf, packageManagerPacman}
+)
+
+// NewDistroRegistry merges configured distros into the built-in ones.
+func NewDistroRegistry(
+	configured map[string]configv1.CliAppDistroContext,
+) (map[appcorev1.CliAppDistro]configv1.CliAppDistroContext, error) {
+	distros := make(map[appcorev1.CliAppDistro]configv1.CliAppDistroContext, len(BuiltinDistros)+len(configured))
+	for name, distro := range BuiltinDistros {
+		distros[name] = distro
+	}
+
+	for name, distro := range configured {
+		if len(name) == 0 {
+			return nil, xerrors.Errorf("distro name can't be empty")
+		}
+
+		if len(distro.ContextImage) == 0 {
+			return nil, xerrors.Errorf("context image of distro %s is empty", name)
+		}
+
+		if len(distro.PackageManager) > 0 {
+			if err := validatePackageManager(distro.PackageManager); err != nil {
+				return nil, xerrors.Errorf("distro %s: %s", name, err)
+			}
+
+			if len(distro.BaseImage) == 0 {
+				return nil, xerrors.Errorf("base image of distro %s is empty while the package manager is set", name)
+			}
+		}
+
+		distros[appcorev1.CliAppDistro(name)] = distro
+	}
+
+	return distros, nil
+}
+
+// NewShellRegistry merges configured shells into the built-in ones.
+func NewShellRegistry(
+	configured map[string]configv1.CliAppShellContext,
+) (map[appcorev1.CliAppShell]configv1.CliAppShellContext, error) {
+	shells := make(map[appcorev1.CliAppShell]configv1.CliAppShellContext, len(BuiltinShells)+len(configured))
+	for name, shell := range BuiltinShells {
+		shells[name] = shell
+	}
+
+	for name, shell := range configured {
+		if len(name) == 0 {
+			return nil, xerrors.Errorf("shell name can't be empty")
+		}
+
+		if len(shell.LoginCommand) == 0 || len(shell.LoginCommand[0]) == 0 {
+			return nil, xerrors.Errorf("login command of shell %s is empty", name)
+		}
+
+		if filepath.IsAbs(shell.RCFile) || strings.HasPrefix(filepath.Clean(shell.RCFile), "..") {
+			return nil, xerrors.Errorf("rc file %s of shell %s must be relative to the home directory",
+				shell.RCFile, name)
+		}
+
+		shells[appcorev1.CliAppShell(name)] = shell
+	}
+
+	return shells, nil
+}
+
+func validatePackageManager(m string) error {
+	for _, manager := range packageManagers {
+		if m == manager {
+			return nil
+		}
+	}
+
+	return xerrors.Errorf("package manager must be one of %q", packageManagers)
+}
+
+func ValidateDistro(distros map[appcorev1.CliAppDistro]configv1.CliAppDistroContext, d appcorev1.CliAppDistro) error {
+	if _, found := distros[d]; found {
+		return nil
+	}
+
+	names := make([]string, 0, len(distros))
+	for name := range distros {
+		names = append(names, string(name))
+	}
+
+	sort.Strings(names)
+	return xerrors.Errorf("Spec.Distro must be one of %q", names)
+}
+
+func ValidateShell(shells map[appcorev1.CliAppShell]configv1.CliAppShellContext, s appcorev1.CliAppShell) error {
+	if _, found := shells[s]; found {
+		return nil
+	}
+
+	names := make([]string, 0, len(shells))
+	for name := range shells {
+		names = append(names, string(name))
+	}
+
+	sort.Strings(names)
+	return xerrors.Errorf("Spec.Shell must be one of %q", names)
+}
+
+func (r *CliAppReconciler) distros() map[appcorev1.CliAppDistro]configv1.CliAppDistroContext {
+	if r.Distros == nil {
+		return BuiltinDistros
+	}
+
+	return r.Distros
+}
+
+func (r *CliAppReconciler) shells() map[appcorev1.CliAppShell]configv1.CliAppShellContext {
+	if r.Shells == nil {
+		return BuiltinShells
+	}
+
+	return r.Shells
+}
+
+// contextImageOf returns the context image of the distro for the shell.
+func contextImageOf(distro *configv1.CliAppDistroContext, sh appcorev1.CliAppShell) string {
+	return strings.ReplaceAll(distro.ContextImage, contextImageShellPlaceholder, strings.ToLower(string(sh)))
+}
+
+// shellContextFilesOf returns the rc file of the shell in the home directory, if set.
+func shellContextFilesOf(shell *configv1.CliAppShellContext) (files []string) {
+	if len(shell.RCFile) > 0 {
+		files = append(files, filepath.Join(shellHome, shell.RCFile))
+	}
+
+	return
+}
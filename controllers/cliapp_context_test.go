@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	configv1 "github.com/warm-metal/cliapp/pkg/apis/config/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("CliApp distro and shell registry", func() {
+	It("should merge configured distros and shells into the built-in ones", func() {
+		distros, err := NewDistroRegistry(map[string]configv1.CliAppDistroContext{
+			"alpine": {ContextImage: "registry.local/context-{shell}-alpine:v1"},
+			"rocky": {
+				ContextImage:   "registry.local/context-{shell}-rocky:v1",
+				BaseImage:      "docker.io/library/rockylinux:8",
+				PackageManager: "dnf",
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ValidateDistro(distros, "rocky")).To(Succeed())
+		Expect(ValidateDistro(distros, appcorev1.CliAppDistroDebian)).To(Succeed())
+		Expect(ValidateDistro(distros, "gentoo")).NotTo(Succeed())
+		alpine := distros[appcorev1.CliAppDistroAlpine]
+		Expect(contextImageOf(&alpine, appcorev1.CliAppShellFish)).To(Equal("registry.local/context-fish-alpine:v1"))
+
+		shells, err := NewShellRegistry(map[string]configv1.CliAppShellContext{
+			"nu": {RCFile: ".config/nushell/config.nu", LoginCommand: []string{"nu", "-l"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ValidateShell(shells, "nu")).To(Succeed())
+		Expect(ValidateShell(shells, appcorev1.CliAppShellSh)).To(Succeed())
+		Expect(ValidateShell(shells, "csh")).NotTo(Succeed())
+	})
+
+	It("should reject invalid registry entries", func() {
+		_, err := NewDistroRegistry(map[string]configv1.CliAppDistroContext{"rocky": {}})
+		Expect(err).To(HaveOccurred())
+		_, err = NewDistroRegistry(map[string]configv1.CliAppDistroContext{
+			"rocky": {ContextImage: "context", BaseImage: "rockylinux:8", PackageManager: "yum"},
+		})
+		Expect(err).To(HaveOccurred())
+		_, err = NewShellRegistry(map[string]configv1.CliAppShellContext{"nu": {}})
+		Expect(err).To(HaveOccurred())
+		_, err = NewShellRegistry(map[string]configv1.CliAppShellContext{
+			"nu": {RCFile: "/etc/nu.nu", LoginCommand: []string{"nu"}},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should mount shell context files from keys named after their base names", func() {
+		r := &CliAppReconciler{ControllerNamespace: "cliapp"}
+		app := &appcorev1.CliApp{}
+		fish := BuiltinShells[appcorev1.CliAppShellFish]
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{}}}}
+		cm := &corev1.ConfigMap{Data: map[string]string{"config.fish": "set -x EDITOR vi", "fish_history": ""}}
+		Expect(r.installShellContext(context.TODO(), pod, &pod.Spec.Containers[0], app, cm, &fish)).To(Succeed())
+		Expect(pod.Spec.Volumes).To(HaveLen(1))
+		Expect(pod.Spec.Volumes[0].CSI.VolumeAttributes["subPath"]).To(Equal("config.fish"))
+		Expect(pod.Spec.Volumes[0].CSI.VolumeAttributes["namespace"]).To(Equal("cliapp"))
+		Expect(pod.Spec.Containers[0].VolumeMounts).To(HaveLen(1))
+		Expect(pod.Spec.Containers[0].VolumeMounts[0].MountPath).To(Equal("/root/.config/fish/config.fish"))
+
+		sh := BuiltinShells[appcorev1.CliAppShellSh]
+		pod = &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{}}}}
+		Expect(r.installShellContext(context.TODO(), pod, &pod.Spec.Containers[0], app,
+			&corev1.ConfigMap{Data: map[string]string{"": ""}}, &sh)).To(Succeed())
+		Expect(pod.Spec.Volumes).To(BeEmpty())
+
+		Expect(checkShellContextConflicts(&corev1.Container{
+			VolumeMounts: []corev1.VolumeMount{{MountPath: "/root/.config/fish/config.fish"}},
+		}, &fish)).NotTo(Succeed())
+	})
+
+	It("should keep shell history out of the workload", func() {
+		Expect(BuiltinShells[appcorev1.CliAppShellBash].HistoryEnv).To(Equal("HISTFILE"))
+		Expect(BuiltinShells[appcorev1.CliAppShellFish].HistoryEnv).To(BeEmpty())
+
+		spec := &appcorev1.CliAppSpec{Image: "alpine:3"}
+		withHistory := spec.DeepCopy()
+		withHistory.ShellHistory = &appcorev1.CliAppShellHistory{Disabled: true, MaxLines: 10}
+		Expect(computeHash(workloadSpec(withHistory))).To(Equal(computeHash(workloadSpec(spec))))
+	})
+})
@@ -20,7 +20,11 @@ import (
 	"context"
 	"golang.org/x/xerrors"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/tools/record"
 	cri "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 	"time"
 
@@ -30,16 +34,19 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	configv1 "github.com/warm-metal/cliapp/pkg/apis/config/v1"
 )
 
 // CliAppReconciler reconciles a CliApp object
 type CliAppReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 
-	CRIImage   cri.ImageServiceClient
-	RestClient resource.RESTClientGetter
+	CRIImage      cri.ImageServiceClient
+	ImageResolver *ImageConfigResolver
+	RestClient    resource.RESTClientGetter
 
 	BuilderEndpoint string
 	ImageBuilder
@@ -47,13 +54,43 @@ type CliAppReconciler struct {
 	DurationIdleLiveLasts time.Duration
 	ControllerNamespace   string
 
+	MaxRetries         int32
+	RetryBackoff       time.Duration
+	RolloutGracePeriod time.Duration
+	// The longest duration a Pod could be unschedulable before the app fails.
+	UnschedulableGracePeriod time.Duration
+
 	DefaultAppContextImage string
 	DefaultShell           appcorev1.CliAppShell
 	DefaultDistro          appcorev1.CliAppDistro
+	// Registries of distros and shells. The built-in ones are used if nil.
+	Distros map[appcorev1.CliAppDistro]configv1.CliAppDistroContext
+	Shells  map[appcorev1.CliAppShell]configv1.CliAppShellContext
+
+	DefaultResources corev1.ResourceRequirements
+	MaxResources     corev1.ResourceList
+
+	NativeToolsImage       string
+	DefaultSecurityProfile appcorev1.CliAppSecurityProfile
+
+	DefaultRootfsProvider appcorev1.CliAppRootfsProvider
+	// Rootfs providers available in the cluster. All providers are allowed if nil.
+	RootfsProviders map[appcorev1.CliAppRootfsProvider]bool
+
+	RegistryMirrors     map[string]string
+	ImagePrefixRewrites map[string]string
+
+	// Persistent homes of session users. Users share the app home if nil.
+	UserHome *configv1.CliAppUserHome
 }
 
 //+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete;deletecollection
 //+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets;serviceaccounts,verbs=get
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;patch;delete
+//+kubebuilder:rbac:groups="storage.k8s.io",resources=csidrivers,verbs=get
+//+kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;patch
 //+kubebuilder:rbac:groups="extensions",resources=deployments;daemonsets;replicasets,verbs=get
 //+kubebuilder:rbac:groups="apps",resources=replicasets;daemonsets;statefulsets;deployments,verbs=get
 //+kubebuilder:rbac:groups="batch",resources=cronjobs;jobs,verbs=get
@@ -78,25 +115,78 @@ func (r *CliAppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 		return result, client.IgnoreNotFound(err)
 	}
 
+	lastStatus := app.Status.DeepCopy()
+	if err = r.resetOutdatedFailure(ctx, log, app); err != nil {
+		return result, err
+	}
+
 	app.Status.Error = ""
+	app.Status.ObservedGeneration = app.Generation
 	defer func() {
 		if err != nil {
 			app.Status.Error = err.Error()
-			if err := r.Status().Update(ctx, app); err != nil {
-				log.Error(err, "unable to update error state")
-			}
-
+			setCondition(app, appcorev1.CliAppConditionDegraded, metav1.ConditionTrue, "ReconcileError", err.Error())
+			r.Recorder.Event(app, corev1.EventTypeWarning, "ReconcileError", err.Error())
 			err = nil
+		} else {
+			setCondition(app, appcorev1.CliAppConditionDegraded, metav1.ConditionFalse, "Reconciled", "")
+		}
+
+		if equality.Semantic.DeepEqual(lastStatus, &app.Status) {
+			return
+		}
+
+		if err := r.Status().Update(ctx, app); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "unable to update app status")
 		}
 	}()
 
-	if err = validateApp(app); err != nil {
+	if err = r.validateApp(app); err != nil {
 		return
 	}
 
-	switch app.Spec.TargetPhase {
+	if err = r.checkSecurity(app); err != nil {
+		return
+	}
+
+	prePullAfter, err := r.prePullImages(ctx, log, app)
+	if err != nil {
+		return
+	}
+
+	targetPhase, wakeAfter, err := keepAliveTarget(&app.Spec, time.Now())
+	if err != nil {
+		return
+	}
+
+	if prePullAfter > 0 && (wakeAfter == 0 || prePullAfter < wakeAfter) {
+		wakeAfter = prePullAfter
+	}
+
+	homeExpiresAfter, err := r.reconcileUserHomes(ctx, log, app)
+	if err != nil {
+		return
+	}
+
+	if homeExpiresAfter > 0 && (wakeAfter == 0 || homeExpiresAfter < wakeAfter) {
+		wakeAfter = homeExpiresAfter
+	}
+
+	if targetPhase == appcorev1.CliAppPhaseLive {
+		if refreshAfter := r.pinImages(ctx, log, app); refreshAfter > 0 && (wakeAfter == 0 || refreshAfter < wakeAfter) {
+			wakeAfter = refreshAfter
+		}
+	}
+
+	defer func() {
+		if wakeAfter > 0 && (result.RequeueAfter == 0 && !result.Requeue || wakeAfter < result.RequeueAfter) {
+			result.RequeueAfter = wakeAfter
+		}
+	}()
+
+	switch targetPhase {
 	case appcorev1.CliAppPhaseRest:
-		if app.Spec.TargetPhase == app.Status.Phase {
+		if targetPhase == app.Status.Phase {
 			return
 		}
 
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"github.com/warm-metal/cliapp/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sort"
+	"time"
+)
+
+const (
+	annoKeyRetry    = "cliapp.warm-metal.tech/retry"
+	maxRetryBackoff = 5 * time.Minute
+)
+
+// Reasons of waiting containers which mean the Pod won't be ready without intervention.
+// ErrImagePull is excluded since kubelet retries the pull, and only backs off after it keeps failing.
+var failedContainerReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"RunContainerError":          true,
+}
+
+// Reasons of warning events of the Pod which mean the Pod won't be ready without intervention.
+var failedEventReasons = map[string]bool{
+	"FailedMount":        true,
+	"FailedAttachVolume": true,
+}
+
+// Reasons of failures which can't be fixed by retries. The app fails immediately until its spec changes.
+var permanentFailureReasons = map[string]bool{
+	commandNotFoundReason:         true,
+	securityProfileViolatedReason: true,
+}
+
+func (r *CliAppReconciler) kubeClient() (*kubernetes.Clientset, error) {
+	config, err := r.RestClient.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(config)
+}
+
+// computeFailureHash computes the spec hash to identify failures. Fields which don't affect the Pod are excluded.
+func computeFailureHash(spec *appcorev1.CliAppSpec) string {
+	return computeHash(workloadSpec(spec))
+}
+
+func retryBackoff(base time.Duration, retries int32) time.Duration {
+	backoff := base
+	for i := int32(1); i < retries && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+
+	return backoff
+}
+
+// resetOutdatedFailure clears the app failure if the spec changed or a retry is requested.
+func (r *CliAppReconciler) resetOutdatedFailure(ctx context.Context, log logr.Logger, app *appcorev1.CliApp) error {
+	if _, found := app.Annotations[annoKeyRetry]; found {
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			if err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Name}, app); err != nil {
+				return err
+			}
+
+			delete(app.Annotations, annoKeyRetry)
+			return r.Update(ctx, app)
+		})
+
+		if err != nil {
+			log.Error(err, "unable to remove the retry annotation")
+			return err
+		}
+
+		if app.Status.Failure != nil {
+			log.Info("retry the failed app")
+			r.Recorder.Event(app, corev1.EventTypeNormal, "Retry", "retry is requested")
+			app.Status.Failure = nil
+		}
+
+		return nil
+	}
+
+	if app.Status.Failure != nil && app.Status.Failure.SpecHash != computeFailureHash(&app.Spec) {
+		log.Info("app spec changed after the last failure")
+		app.Status.Failure = nil
+	}
+
+	return nil
+}
+
+func (r *CliAppReconciler) isFailed(app *appcorev1.CliApp) bool {
+	return app.Status.Failure != nil && app.Status.Failure.Retries >= r.MaxRetries
+}
+
+// recordFailure records a failure of the app. The app transits to phase Failed if retries exceed the limit,
+// or will be retried after the returned result.
+func (r *CliAppReconciler) recordFailure(
+	ctx context.Context, log logr.Logger, app *appcorev1.CliApp, reason, message string,
+) (result ctrl.Result, err error) {
+	if app.Status.Failure == nil {
+		app.Status.Failure = &appcorev1.CliAppFailure{
+			SpecHash: computeFailureHash(&app.Spec),
+		}
+	}
+
+	app.Status.Failure.Reason = reason
+	app.Status.Failure.Message = message
+	app.Status.Failure.Retries++
+	if permanentFailureReasons[reason] {
+		app.Status.Failure.Retries = r.MaxRetries
+	}
+	app.Status.Failure.Time = metav1.Now()
+
+	log.Info("app failed", "reason", reason, "message", message, "retries", app.Status.Failure.Retries)
+	r.Recorder.Eventf(app, corev1.EventTypeWarning, reason, "%s (retries %d/%d)",
+		message, app.Status.Failure.Retries, r.MaxRetries)
+	setCondition(app, appcorev1.CliAppConditionReady, metav1.ConditionFalse, reason, message)
+
+	if r.isFailed(app) {
+		app.Status.PodName = ""
+		err = r.transitPhaseTo(ctx, log, app, appcorev1.CliAppPhaseFailed)
+		return
+	}
+
+	result.RequeueAfter = retryBackoff(r.RetryBackoff, app.Status.Failure.Retries)
+	return
+}
+
+// waitForRetry returns a positive duration if the app should wait before the next retry.
+func (r *CliAppReconciler) waitForRetry(app *appcorev1.CliApp) time.Duration {
+	if app.Status.Failure == nil {
+		return 0
+	}
+
+	next := app.Status.Failure.Time.Add(retryBackoff(r.RetryBackoff, app.Status.Failure.Retries))
+	return time.Until(next)
+}
+
+// unschedulableGraceLeft returns the PodScheduled condition if the Pod is unschedulable, and the duration left
+// before it is taken as a failure. Pods could be scheduled later, such as after the cluster scales up.
+func (r *CliAppReconciler) unschedulableGraceLeft(pod *corev1.Pod) (*corev1.PodCondition, time.Duration) {
+	_, scheduled := utils.GetPodCondition(&pod.Status, corev1.PodScheduled)
+	if scheduled == nil || scheduled.Status != corev1.ConditionFalse ||
+		scheduled.Reason != corev1.PodReasonUnschedulable {
+		return nil, 0
+	}
+
+	return scheduled, time.Until(scheduled.LastTransitionTime.Add(r.UnschedulableGracePeriod))
+}
+
+// diagnosePod checks whether the Pod fails to start. It returns an empty reason if no failure found.
+func (r *CliAppReconciler) diagnosePod(
+	ctx context.Context, log logr.Logger, pod *corev1.Pod,
+) (reason, message string) {
+	if pod.Status.Phase == corev1.PodFailed {
+		reason = "PodFailed"
+		if len(pod.Status.Reason) > 0 {
+			reason = pod.Status.Reason
+		}
+
+		return reason, pod.Status.Message
+	}
+
+	if scheduled, left := r.unschedulableGraceLeft(pod); scheduled != nil && left <= 0 {
+		return scheduled.Reason, scheduled.Message
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Waiting != nil && failedContainerReasons[status.State.Waiting.Reason] {
+			reason = status.State.Waiting.Reason
+			message = fmt.Sprintf("container %s: %s", status.Name, status.State.Waiting.Message)
+			break
+		}
+	}
+
+	// The command probe restarts the workspace container, so its failure takes precedence over container states.
+	if len(reason) > 0 && !hasCommandProbe(pod) {
+		return
+	}
+
+	clientset, err := r.kubeClient()
+	if err != nil {
+		log.Error(err, "unable to create clientset")
+		return
+	}
+
+	events, err := clientset.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.kind": "Pod",
+			"involvedObject.name": pod.Name,
+			"involvedObject.uid":  string(pod.UID),
+			"type":                corev1.EventTypeWarning,
+		}.AsSelector().String(),
+	})
+	if err != nil {
+		log.Error(err, "unable to list events of pod", "pod", pod.Name)
+		return
+	}
+
+	sort.SliceStable(events.Items, func(i, j int) bool {
+		return events.Items[i].LastTimestamp.After(events.Items[j].LastTimestamp.Time)
+	})
+
+	for i := range events.Items {
+		if commandMessage, found := commandNotFound(&events.Items[i]); found {
+			return commandNotFoundReason, commandMessage
+		}
+	}
+
+	if len(reason) > 0 {
+		return
+	}
+
+	for _, ev := range events.Items {
+		if failedEventReasons[ev.Reason] {
+			return ev.Reason, ev.Message
+		}
+	}
+
+	return
+}
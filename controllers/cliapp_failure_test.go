@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"time"
+)
+
+var _ = Describe("CliApp failures", func() {
+	It("should back off exponentially", func() {
+		Expect(retryBackoff(10*time.Second, 1)).To(Equal(10 * time.Second))
+		Expect(retryBackoff(10*time.Second, 3)).To(Equal(40 * time.Second))
+		Expect(retryBackoff(10*time.Second, 100)).To(Equal(maxRetryBackoff))
+	})
+
+	It("should detect pods which won't be ready", func() {
+		r := &CliAppReconciler{UnschedulableGracePeriod: DefaultUnschedulableGrace}
+		log := ctrl.Log.WithName("test")
+		reason, _ := r.diagnosePod(context.TODO(), log, &corev1.Pod{
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: appContainer,
+						State: corev1.ContainerState{
+							Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+						},
+					},
+				},
+			},
+		})
+		Expect(reason).To(Equal("CrashLoopBackOff"))
+
+		reason, _ = r.diagnosePod(context.TODO(), log, &corev1.Pod{
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{
+					{
+						Type:               corev1.PodScheduled,
+						Status:             corev1.ConditionFalse,
+						Reason:             corev1.PodReasonUnschedulable,
+						LastTransitionTime: metav1.NewTime(time.Now().Add(-2 * DefaultUnschedulableGrace)),
+					},
+				},
+			},
+		})
+		Expect(reason).To(Equal(corev1.PodReasonUnschedulable))
+	})
+
+	It("should wait for pods in transient states", func() {
+		r := &CliAppReconciler{UnschedulableGracePeriod: DefaultUnschedulableGrace}
+		pod := &corev1.Pod{
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{
+					{
+						Type:               corev1.PodScheduled,
+						Status:             corev1.ConditionFalse,
+						Reason:             corev1.PodReasonUnschedulable,
+						LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Minute)),
+					},
+				},
+			},
+		}
+		scheduled, left := r.unschedulableGraceLeft(pod)
+		Expect(scheduled).NotTo(BeNil())
+		Expect(left).To(BeNumerically(">", 3*time.Minute))
+		Expect(left).To(BeNumerically("<=", 4*time.Minute))
+
+		scheduled, left = r.unschedulableGraceLeft(&corev1.Pod{})
+		Expect(scheduled).To(BeNil())
+		Expect(left).To(BeZero())
+
+		// Kubelet retries failed pulls, and backs off once they keep failing.
+		Expect(failedContainerReasons).NotTo(HaveKey("ErrImagePull"))
+		Expect(failedContainerReasons).To(HaveKey("ImagePullBackOff"))
+	})
+})
@@ -0,0 +1,433 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	configv1 "github.com/warm-metal/cliapp/pkg/apis/config/v1"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"path/filepath"
+	"regexp"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// annotation of apps the session gate records users in, as a JSON map from user keys to the time of their
+	// last sessions. The same annotation of Pods is the comma-separated user keys whose homes are mounted.
+	annoKeyHomeUsers = "cliapp.warm-metal.tech/home-users"
+
+	// annotation of user home PVCs, the last time an app Pod mounted them.
+	annoKeyHomeLastUsed = "cliapp.warm-metal.tech/home-last-used"
+
+	// label of user home PVCs, the user key.
+	labelHomeUser = "cliapp.warm-metal.tech/home-user"
+
+	userHomePVCPrefix    = "cliapp-home-"
+	userHomeVolumePrefix = "user-home-"
+
+	// directory user homes are mounted in.
+	userHomeDir = "/home/cliapp"
+
+	DefaultUserHomeIdlePeriod = 7 * 24 * time.Hour
+)
+
+var (
+	DefaultUserHomeSize = resource.MustParse("1Gi")
+
+	// User keys are hashes of user names generated by the session gate.
+	userKeyPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+)
+
+// NewUserHomeConfig validates the user home configuration and fills defaults.
+func NewUserHomeConfig(home *configv1.CliAppUserHome) (*configv1.CliAppUserHome, error) {
+	if home == nil {
+		return nil, nil
+	}
+
+	home = home.DeepCopy()
+	if home.Size == nil {
+		size := DefaultUserHomeSize.DeepCopy()
+		home.Size = &size
+	} else if home.Size.Sign() <= 0 {
+		return nil, xerrors.Errorf("size of user homes must be positive")
+	}
+
+	// Homes are shared by apps in the same namespace, and by outdated Pods which are still serving sessions.
+	if len(home.AccessModes) == 0 {
+		home.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}
+	}
+
+	rwx := false
+	for _, mode := range home.AccessModes {
+		rwx = rwx || mode == corev1.ReadWriteMany
+	}
+
+	if !rwx {
+		return nil, xerrors.Errorf("access modes of user homes must include %s", corev1.ReadWriteMany)
+	}
+
+	switch home.RetentionPolicy {
+	case "":
+		home.RetentionPolicy = configv1.CliAppUserHomeRetain
+	case configv1.CliAppUserHomeRetain, configv1.CliAppUserHomeDelete:
+	default:
+		return nil, xerrors.Errorf("retention policy of user homes must be either %s or %s",
+			configv1.CliAppUserHomeRetain, configv1.CliAppUserHomeDelete)
+	}
+
+	if home.IdlePeriod.Duration <= 0 {
+		home.IdlePeriod.Duration = DefaultUserHomeIdlePeriod
+	}
+
+	return home, nil
+}
+
+// homeUsersOf returns users the session gate records in the app and the time of their last sessions.
+// Invalid entries are ignored.
+func homeUsersOf(app *appcorev1.CliApp) map[string]time.Time {
+	value := app.Annotations[annoKeyHomeUsers]
+	if len(value) == 0 {
+		return nil
+	}
+
+	recorded := map[string]string{}
+	if err := json.Unmarshal([]byte(value), &recorded); err != nil {
+		return nil
+	}
+
+	users := make(map[string]time.Time, len(recorded))
+	for user, at := range recorded {
+		if !userKeyPattern.MatchString(user) {
+			continue
+		}
+
+		lastSession, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			continue
+		}
+
+		users[user] = lastSession
+	}
+
+	return users
+}
+
+// mountedHomeUsers returns sorted users whose homes are mounted in the app Pod.
+func (r *CliAppReconciler) mountedHomeUsers(app *appcorev1.CliApp) []string {
+	if r.UserHome == nil || !app.Spec.SharedUserHomes {
+		return nil
+	}
+
+	recorded := homeUsersOf(app)
+	users := make([]string, 0, len(recorded))
+	for user := range recorded {
+		users = append(users, user)
+	}
+
+	sort.Strings(users)
+	return users
+}
+
+// ensureUserHomes creates PVCs of users if they don't exist, and marks them used.
+func (r *CliAppReconciler) ensureUserHomes(
+	ctx context.Context, log logr.Logger, namespace string, users []string,
+) error {
+	for _, user := range users {
+		found, err := r.touchUserHome(ctx, namespace, user)
+		if err != nil {
+			return err
+		}
+
+		if found {
+			continue
+		}
+
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        userHomePVCPrefix + user,
+				Namespace:   namespace,
+				Labels:      map[string]string{labelHomeUser: user},
+				Annotations: map[string]string{annoKeyHomeLastUsed: time.Now().UTC().Format(time.RFC3339)},
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      r.UserHome.AccessModes,
+				StorageClassName: r.UserHome.StorageClassName,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: *r.UserHome.Size},
+				},
+			},
+		}
+
+		log.Info("create user home", "pvc", pvc.Name)
+		if err = r.Create(ctx, pvc); err != nil && !errors.IsAlreadyExists(err) {
+			return xerrors.Errorf("unable to create user home %s: %s", pvc.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// touchUserHome marks the PVC of the user used if it exists.
+func (r *CliAppReconciler) touchUserHome(ctx context.Context, namespace, user string) (found bool, err error) {
+	pvc := &corev1.PersistentVolumeClaim{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: userHomePVCPrefix + user}, pvc)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, xerrors.Errorf("unable to fetch user home %s: %s", pvc.Name, err)
+	}
+
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, annoKeyHomeLastUsed,
+		time.Now().UTC().Format(time.RFC3339))
+	if err = r.Patch(ctx, pvc, client.RawPatch(types.MergePatchType, []byte(patch))); err != nil {
+		return true, xerrors.Errorf("unable to update user home %s: %s", pvc.Name, err)
+	}
+
+	return true, nil
+}
+
+// validateUserHomes checks whether homes of users could be mounted in the app rootfs, where chrooted commands
+// see them.
+func (r *CliAppReconciler) validateUserHomes(spec *appcorev1.CliAppSpec) error {
+	if r.UserHome == nil || !spec.SharedUserHomes {
+		return nil
+	}
+
+	return r.checkRootfsMounts(spec, "user homes")
+}
+
+// installUserHomes mounts PVCs of users at their homes. Files the container mounts in the home directory,
+// such as the shell context, are also mounted in homes of users. In the Chroot mode, homes are also mounted at
+// the same path in the app rootfs for chrooted commands.
+func installUserHomes(pod *corev1.Pod, container *corev1.Container, users []string) {
+	if len(users) == 0 {
+		return
+	}
+
+	chroot := false
+	homeMounts := make([]corev1.VolumeMount, 0, len(container.VolumeMounts))
+	for _, mount := range container.VolumeMounts {
+		if strings.HasPrefix(mount.MountPath, shellHome+"/") {
+			homeMounts = append(homeMounts, mount)
+		}
+
+		chroot = chroot || mount.MountPath == appRoot
+	}
+
+	for _, user := range users {
+		home := filepath.Join(userHomeDir, user)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: userHomeVolumePrefix + user,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: userHomePVCPrefix + user,
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      userHomeVolumePrefix + user,
+			MountPath: home,
+		})
+
+		if chroot {
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+				Name:      userHomeVolumePrefix + user,
+				MountPath: filepath.Join(appRoot, home),
+			})
+		}
+
+		for _, mount := range homeMounts {
+			mount.MountPath = filepath.Join(home, strings.TrimPrefix(mount.MountPath, shellHome))
+			container.VolumeMounts = append(container.VolumeMounts, mount)
+		}
+	}
+
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+
+	pod.Annotations[annoKeyHomeUsers] = strings.Join(users, ",")
+}
+
+// releaseUserHomes marks homes of the app used after its Pods are gone, and forgets users who have no session
+// in the idle period, so that they are no longer mounted.
+func (r *CliAppReconciler) releaseUserHomes(ctx context.Context, log logr.Logger, app *appcorev1.CliApp) error {
+	if r.UserHome == nil {
+		return nil
+	}
+
+	recorded := homeUsersOf(app)
+	if len(recorded) == 0 {
+		return nil
+	}
+
+	active := make(map[string]string, len(recorded))
+	for user, lastSession := range recorded {
+		if _, err := r.touchUserHome(ctx, app.Namespace, user); err != nil {
+			return err
+		}
+
+		if time.Since(lastSession) < r.UserHome.IdlePeriod.Duration {
+			active[user] = lastSession.UTC().Format(time.RFC3339)
+		}
+	}
+
+	if len(active) == len(recorded) {
+		return nil
+	}
+
+	log.Info("forget idle users", "users", len(recorded)-len(active))
+	value, err := json.Marshal(active)
+	if err != nil {
+		panic(err)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{annoKeyHomeUsers: string(value)},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// The patch overwrites the status in memory.
+	status := app.Status.DeepCopy()
+	defer func() { app.Status = *status }()
+	return r.Patch(ctx, app, client.RawPatch(types.MergePatchType, patch))
+}
+
+// checkHomesMounted updates the condition UserHomesMounted according to users whose homes are mounted in the app
+// Pod. Homes are only mounted when Pods are created, so new users wait for the app to restart.
+func (r *CliAppReconciler) checkHomesMounted(ctx context.Context, app *appcorev1.CliApp) error {
+	if len(app.Status.PodName) == 0 {
+		meta.RemoveStatusCondition(&app.Status.Conditions, appcorev1.CliAppConditionUserHomesMounted)
+		return nil
+	}
+
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: app.Status.PodName}, pod)
+	if errors.IsNotFound(err) {
+		meta.RemoveStatusCondition(&app.Status.Conditions, appcorev1.CliAppConditionUserHomesMounted)
+		return nil
+	}
+
+	if err != nil {
+		return xerrors.Errorf("unable to fetch Pod %s: %s", app.Status.PodName, err)
+	}
+
+	mounted := make(map[string]bool)
+	for _, user := range strings.Split(pod.Annotations[annoKeyHomeUsers], ",") {
+		mounted[user] = true
+	}
+
+	pending := 0
+	for _, user := range r.mountedHomeUsers(app) {
+		if !mounted[user] {
+			pending++
+		}
+	}
+
+	if pending > 0 {
+		setCondition(app, appcorev1.CliAppConditionUserHomesMounted, metav1.ConditionFalse, "RestartPending",
+			fmt.Sprintf("homes of %d users are mounted once the app restarts", pending))
+		return nil
+	}
+
+	setCondition(app, appcorev1.CliAppConditionUserHomesMounted, metav1.ConditionTrue, "Mounted",
+		"homes of all users are mounted")
+	return nil
+}
+
+// reconcileUserHomes publishes the home directory of users to the session gate if the app keeps user homes,
+// and deletes idle user homes of the app namespace if the retention policy is Delete. It returns the duration after which the next home
+// would expire.
+func (r *CliAppReconciler) reconcileUserHomes(
+	ctx context.Context, log logr.Logger, app *appcorev1.CliApp,
+) (wakeAfter time.Duration, err error) {
+	app.Status.UserHomeDir = ""
+	if r.UserHome == nil || !app.Spec.SharedUserHomes {
+		meta.RemoveStatusCondition(&app.Status.Conditions, appcorev1.CliAppConditionUserHomesMounted)
+	} else {
+		app.Status.UserHomeDir = userHomeDir
+		if err = r.checkHomesMounted(ctx, app); err != nil {
+			return
+		}
+	}
+
+	if r.UserHome == nil {
+		return
+	}
+
+	if r.UserHome.RetentionPolicy != configv1.CliAppUserHomeDelete {
+		return
+	}
+
+	pvcList := &corev1.PersistentVolumeClaimList{}
+	if err = r.List(ctx, pvcList, client.InNamespace(app.Namespace), client.HasLabels{labelHomeUser}); err != nil {
+		err = xerrors.Errorf("unable to list user homes: %s", err)
+		return
+	}
+
+	if len(pvcList.Items) == 0 {
+		return
+	}
+
+	podList := &corev1.PodList{}
+	if err = r.List(ctx, podList, client.InNamespace(app.Namespace), client.HasLabels{appLabel}); err != nil {
+		err = xerrors.Errorf("unable to list Pods: %s", err)
+		return
+	}
+
+	mounted := make(map[string]bool)
+	for i := range podList.Items {
+		for _, volume := range podList.Items[i].Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil {
+				mounted[volume.PersistentVolumeClaim.ClaimName] = true
+			}
+		}
+	}
+
+	for i := range pvcList.Items {
+		pvc := &pvcList.Items[i]
+		if mounted[pvc.Name] || pvc.DeletionTimestamp != nil {
+			continue
+		}
+
+		lastUsed, failed := time.Parse(time.RFC3339, pvc.Annotations[annoKeyHomeLastUsed])
+		if failed != nil {
+			lastUsed = pvc.CreationTimestamp.Time
+		}
+
+		if remaining := r.UserHome.IdlePeriod.Duration - time.Since(lastUsed); remaining > 0 {
+			if wakeAfter == 0 || remaining < wakeAfter {
+				wakeAfter = remaining
+			}
+
+			continue
+		}
+
+		log.Info("delete idle user home", "pvc", pvc.Name, "lastUsed", lastUsed)
+		if err = r.Delete(ctx, pvc); err != nil && !errors.IsNotFound(err) {
+			err = xerrors.Errorf("unable to delete user home %s: %s", pvc.Name, err)
+			return
+		}
+
+		err = nil
+	}
+
+	return
+}
@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	configv1 "github.com/warm-metal/cliapp/pkg/apis/config/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"strings"
+	"time"
+)
+
+var _ = Describe("CliApp user homes", func() {
+	alice := strings.Repeat("a", 32)
+	bob := strings.Repeat("b", 32)
+
+	newApp := func(users map[string]time.Time) *appcorev1.CliApp {
+		recorded := map[string]string{}
+		for user, at := range users {
+			recorded[user] = at.UTC().Format(time.RFC3339)
+		}
+
+		value, err := json.Marshal(recorded)
+		Expect(err).NotTo(HaveOccurred())
+		app := &appcorev1.CliApp{}
+		app.Namespace = "default"
+		app.Name = "kubectl"
+		app.Annotations = map[string]string{annoKeyHomeUsers: string(value)}
+		app.Spec.SharedUserHomes = true
+		return app
+	}
+
+	newReconciler := func(policy configv1.CliAppUserHomeRetentionPolicy, objs ...runtime.Object) *CliAppReconciler {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(appcorev1.AddToScheme(scheme)).To(Succeed())
+		home, err := NewUserHomeConfig(&configv1.CliAppUserHome{RetentionPolicy: policy})
+		Expect(err).NotTo(HaveOccurred())
+		return &CliAppReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build(),
+			UserHome: home,
+		}
+	}
+
+	It("should fill defaults of the user home configuration", func() {
+		home, err := NewUserHomeConfig(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(home).To(BeNil())
+
+		home, err = NewUserHomeConfig(&configv1.CliAppUserHome{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(home.Size.String()).To(Equal("1Gi"))
+		Expect(home.AccessModes).To(Equal([]corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}))
+		Expect(home.RetentionPolicy).To(Equal(configv1.CliAppUserHomeRetain))
+		Expect(home.IdlePeriod.Duration).To(Equal(DefaultUserHomeIdlePeriod))
+
+		_, err = NewUserHomeConfig(&configv1.CliAppUserHome{RetentionPolicy: "Recycle"})
+		Expect(err).To(HaveOccurred())
+
+		_, err = NewUserHomeConfig(&configv1.CliAppUserHome{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should mount homes of recorded users along with files in the home directory", func() {
+		r := newReconciler(configv1.CliAppUserHomeRetain)
+		app := newApp(map[string]time.Time{bob: time.Now(), alice: time.Now()})
+		app.Annotations[annoKeyHomeUsers] = strings.TrimSuffix(app.Annotations[annoKeyHomeUsers], "}") +
+			`,"Carol":"2021-01-01T00:00:00Z"}`
+		users := r.mountedHomeUsers(app)
+		Expect(users).To(Equal([]string{alice, bob}))
+
+		optedOut := app.DeepCopy()
+		optedOut.Spec.SharedUserHomes = false
+		Expect(r.mountedHomeUsers(optedOut)).To(BeEmpty())
+
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			VolumeMounts: []corev1.VolumeMount{
+				{Name: "shell-rc", MountPath: "/root/.bash_profile"},
+				{Name: "data", MountPath: "/data"},
+			},
+		}}}}
+		installUserHomes(pod, &pod.Spec.Containers[0], users)
+		Expect(pod.Annotations[annoKeyHomeUsers]).To(Equal(alice + "," + bob))
+		Expect(pod.Spec.Volumes).To(HaveLen(2))
+		Expect(pod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("cliapp-home-" + alice))
+
+		mounts := map[string]string{}
+		for _, m := range pod.Spec.Containers[0].VolumeMounts {
+			mounts[m.MountPath] = m.Name
+		}
+
+		Expect(mounts).To(HaveKeyWithValue("/home/cliapp/"+alice, "user-home-"+alice))
+		Expect(mounts).To(HaveKeyWithValue("/home/cliapp/"+alice+"/.bash_profile", "shell-rc"))
+		Expect(mounts).To(HaveKeyWithValue("/home/cliapp/"+bob+"/.bash_profile", "shell-rc"))
+		Expect(mounts).NotTo(HaveKey("/home/cliapp/" + bob + "/data"))
+		Expect(mounts).NotTo(HaveKey("/app-root/home/cliapp/" + alice))
+
+		pod = &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			VolumeMounts: []corev1.VolumeMount{{Name: appImageVolume, MountPath: appRoot}},
+		}}}}
+		installUserHomes(pod, &pod.Spec.Containers[0], users)
+		mounts = map[string]string{}
+		for _, m := range pod.Spec.Containers[0].VolumeMounts {
+			mounts[m.MountPath] = m.Name
+		}
+
+		Expect(mounts).To(HaveKeyWithValue("/home/cliapp/"+alice, "user-home-"+alice))
+		Expect(mounts).To(HaveKeyWithValue("/app-root/home/cliapp/"+alice, "user-home-"+alice))
+		Expect(mounts).To(HaveKeyWithValue("/app-root/home/cliapp/"+bob, "user-home-"+bob))
+	})
+
+	It("should refuse user homes in read-only rootfs", func() {
+		r := newReconciler(configv1.CliAppUserHomeRetain)
+		r.DefaultRootfsProvider = appcorev1.CliAppRootfsProviderImageVolume
+		app := newApp(nil)
+		Expect(r.validateUserHomes(&app.Spec)).NotTo(Succeed())
+
+		app.Spec.ExecutionMode = appcorev1.CliAppExecutionModeNative
+		Expect(r.validateUserHomes(&app.Spec)).To(Succeed())
+
+		app = newApp(nil)
+		app.Spec.RootfsProvider = appcorev1.CliAppRootfsProviderInitContainer
+		Expect(r.validateUserHomes(&app.Spec)).To(Succeed())
+
+		app.Spec.SharedUserHomes = false
+		app.Spec.RootfsProvider = ""
+		Expect(r.validateUserHomes(&app.Spec)).To(Succeed())
+	})
+
+	It("should report homes waiting for the app to restart", func() {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "kubectl-x",
+			Annotations: map[string]string{annoKeyHomeUsers: alice},
+		}}
+		r := newReconciler(configv1.CliAppUserHomeRetain, pod)
+		app := newApp(map[string]time.Time{alice: time.Now(), bob: time.Now()})
+		_, err := r.reconcileUserHomes(context.TODO(), ctrl.Log, app)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.FindStatusCondition(app.Status.Conditions, appcorev1.CliAppConditionUserHomesMounted)).To(BeNil())
+
+		app.Status.PodName = pod.Name
+		_, err = r.reconcileUserHomes(context.TODO(), ctrl.Log, app)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionFalse(app.Status.Conditions, appcorev1.CliAppConditionUserHomesMounted)).
+			To(BeTrue())
+
+		pod.Annotations[annoKeyHomeUsers] = alice + "," + bob
+		Expect(r.Update(context.TODO(), pod)).To(Succeed())
+		_, err = r.reconcileUserHomes(context.TODO(), ctrl.Log, app)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(app.Status.Conditions, appcorev1.CliAppConditionUserHomesMounted)).
+			To(BeTrue())
+
+		app.Spec.SharedUserHomes = false
+		_, err = r.reconcileUserHomes(context.TODO(), ctrl.Log, app)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.FindStatusCondition(app.Status.Conditions, appcorev1.CliAppConditionUserHomesMounted)).To(BeNil())
+	})
+
+	It("should provision homes and forget idle users", func() {
+		r := newReconciler(configv1.CliAppUserHomeRetain)
+		app := newApp(map[string]time.Time{alice: time.Now(), bob: time.Now().Add(-2 * DefaultUserHomeIdlePeriod)})
+		Expect(r.Create(context.TODO(), app)).To(Succeed())
+		Expect(r.ensureUserHomes(context.TODO(), ctrl.Log, app.Namespace, r.mountedHomeUsers(app))).To(Succeed())
+
+		pvc := &corev1.PersistentVolumeClaim{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "cliapp-home-" + alice}, pvc)).
+			To(Succeed())
+		Expect(pvc.Labels[labelHomeUser]).To(Equal(alice))
+		Expect(pvc.Spec.Resources.Requests.Storage().String()).To(Equal("1Gi"))
+
+		app.Status.UserHomeDir = userHomeDir
+		Expect(r.releaseUserHomes(context.TODO(), ctrl.Log, app)).To(Succeed())
+		Expect(app.Status.UserHomeDir).To(Equal(userHomeDir))
+		Expect(r.mountedHomeUsers(app)).To(Equal([]string{alice}))
+	})
+
+	It("should delete homes idle for the period if the retention policy is Delete", func() {
+		idleSince := time.Now().Add(-2 * DefaultUserHomeIdlePeriod).UTC().Format(time.RFC3339)
+		home := func(user, lastUsed string) *corev1.PersistentVolumeClaim {
+			return &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        "cliapp-home-" + user,
+				Labels:      map[string]string{labelHomeUser: user},
+				Annotations: map[string]string{annoKeyHomeLastUsed: lastUsed},
+			}}
+		}
+
+		carol := strings.Repeat("c", 32)
+		mounting := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "kubectl-x",
+				Labels:    map[string]string{appLabel: "kubectl"},
+			},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+				Name: "user-home-" + carol,
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "cliapp-home-" + carol},
+				},
+			}}},
+		}
+
+		r := newReconciler(configv1.CliAppUserHomeDelete, mounting, home(alice, idleSince),
+			home(bob, time.Now().UTC().Format(time.RFC3339)), home(carol, idleSince))
+		app := newApp(nil)
+		wakeAfter, err := r.reconcileUserHomes(context.TODO(), ctrl.Log, app)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(app.Status.UserHomeDir).To(Equal(userHomeDir))
+		Expect(wakeAfter).To(BeNumerically(">", 0))
+		Expect(wakeAfter).To(BeNumerically("<=", DefaultUserHomeIdlePeriod))
+
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "cliapp-home-" + alice}, pvc)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		Expect(r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "cliapp-home-" + bob}, pvc)).
+			To(Succeed())
+		Expect(r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "cliapp-home-" + carol}, pvc)).
+			To(Succeed())
+
+		app.Spec.SharedUserHomes = false
+		_, err = r.reconcileUserHomes(context.TODO(), ctrl.Log, app)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(app.Status.UserHomeDir).To(BeEmpty())
+	})
+})
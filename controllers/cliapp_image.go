@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-logr/logr"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	cri "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"path/filepath"
+	"strings"
+)
+
+// Variables of the image which are not passed to the workspace container since the app context depends on them.
+// They are still available to commands in the app rootfs.
+var reservedImageEnvs = map[string]bool{
+	"PATH":     true,
+	"HOME":     true,
+	"SHELL":    true,
+	"APP_ROOT": true,
+	"DISTRO":   true,
+}
+
+// rewriteImagePaths rewrites values which are absolute paths, or lists of absolute paths separated by colons,
+// to paths under the app root. Other values are kept.
+func rewriteImagePaths(value string) string {
+	if !strings.HasPrefix(value, "/") {
+		return value
+	}
+
+	paths := strings.Split(value, ":")
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			return value
+		}
+	}
+
+	for i := range paths {
+		paths[i] = filepath.Join(appRoot, paths[i])
+	}
+
+	return strings.Join(paths, ":")
+}
+
+// imageEnvs converts variables of the image to variables of the workspace container. Paths are rewritten
+// to be under the app root.
+func imageEnvs(env []string) (envs []corev1.EnvVar) {
+	for _, kv := range env {
+		envPair := strings.SplitN(kv, "=", 2)
+		if len(envPair) != 2 || len(envPair[0]) == 0 || reservedImageEnvs[envPair[0]] {
+			continue
+		}
+
+		envs = append(envs, corev1.EnvVar{
+			Name:  envPair[0],
+			Value: rewriteImagePaths(envPair[1]),
+		})
+	}
+
+	return
+}
+
+type imageInfo struct {
+	Spec struct {
+		Config struct {
+			User       string   `json:"User,omitempty"`
+			Env        []string `json:"Env,omitempty"`
+			Entrypoint []string `json:"Entrypoint,omitempty"`
+			Cmd        []string `json:"Cmd,omitempty"`
+			WorkingDir string   `json:"WorkingDir,omitempty"`
+		} `json:"config,omitempty"`
+	} `json:"imageSpec,omitempty"`
+}
+
+// imageConfiguration is the part of image configuration the app depends on.
+type imageConfiguration struct {
+	appcorev1.CliAppImageConfig
+	Path   string
+	Digest string
+}
+
+// fetchImageConfiguration fetches configuration of the image from its registry, with pull secrets of the Pod.
+// The image status of the local CRI is used if the registry is unavailable.
+func (r *CliAppReconciler) fetchImageConfiguration(
+	ctx context.Context, log logr.Logger, app *appcorev1.CliApp, pod *corev1.Pod, image string,
+) (config imageConfiguration, err error) {
+	if r.ImageResolver != nil {
+		creds, err := r.imagePullCredentials(ctx, log, app, pod)
+		if err != nil {
+			log.Error(err, "unable to fetch pull secrets", "pod", pod.Name)
+		}
+
+		config, err = r.ImageResolver.Resolve(ctx, log, image, creds)
+		if err == nil {
+			return config, nil
+		}
+
+		log.Error(err, "unable to fetch image config from registry. fallback to CRI", "image", image)
+	}
+
+	return r.fetchImageConfigurationFromCRI(ctx, log, image)
+}
+
+func (r *CliAppReconciler) fetchImageConfigurationFromCRI(
+	ctx context.Context, log logr.Logger, image string,
+) (config imageConfiguration, err error) {
+	if r.CRIImage == nil {
+		return config, xerrors.Errorf("unable to fetch config of image %s", image)
+	}
+
+	resp, err := r.CRIImage.ImageStatus(ctx, &cri.ImageStatusRequest{
+		Image:   &cri.ImageSpec{Image: image},
+		Verbose: true,
+	})
+
+	if err != nil {
+		return
+	}
+
+	if resp.Image != nil && len(resp.Image.RepoDigests) > 0 {
+		config.Digest = resp.Image.RepoDigests[0]
+	}
+
+	if len(resp.Info) == 0 {
+		log.Info("no info found for image", "image", image)
+		return
+	}
+
+	if resp.Info["info"] == "" {
+		log.Info("no image info found for image", "image", image)
+		return
+	}
+
+	info := imageInfo{}
+	if err = json.Unmarshal([]byte(resp.Info["info"]), &info); err != nil {
+		log.Error(err, "unable to decode the image spec", "image", image, "spec", resp.Info["info"])
+		return
+	}
+
+	config.Path = pathOf(info.Spec.Config.Env)
+	config.Env = info.Spec.Config.Env
+	config.User = info.Spec.Config.User
+	config.Entrypoint = info.Spec.Config.Entrypoint
+	config.Cmd = info.Spec.Config.Cmd
+	config.WorkingDir = info.Spec.Config.WorkingDir
+	return
+}
+
+func pathOf(env []string) string {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "PATH=") {
+			return kv[len("PATH="):]
+		}
+	}
+
+	return ""
+}
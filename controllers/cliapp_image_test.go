@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("CliApp image config", func() {
+	It("should rewrite paths in image variables", func() {
+		Expect(imageEnvs([]string{
+			"PATH=/usr/bin",
+			"HOME=/home/app",
+			"JAVA_HOME=/opt/java",
+			"CLASSPATH=/opt/lib:/opt/ext",
+			"LANG=C.UTF-8",
+			"PROXY=http://proxy:3128",
+			"OPTS=-Dkey=value",
+		})).To(Equal([]corev1.EnvVar{
+			{Name: "JAVA_HOME", Value: "/app-root/opt/java"},
+			{Name: "CLASSPATH", Value: "/app-root/opt/lib:/app-root/opt/ext"},
+			{Name: "LANG", Value: "C.UTF-8"},
+			{Name: "PROXY", Value: "http://proxy:3128"},
+			{Name: "OPTS", Value: "-Dkey=value"},
+		}))
+	})
+
+	It("should probe the image entrypoint", func() {
+		config := &imageConfiguration{}
+		config.Entrypoint = []string{"/usr/bin/kubectl"}
+		config.Cmd = []string{"help"}
+		probe := commandProbe(&appcorev1.CliAppSpec{UseImageEntrypoint: true}, config, nil)
+		Expect(probe).NotTo(BeNil())
+		Expect(probe.Exec.Command[2]).To(ContainSubstring("/app-root/usr/bin/kubectl"))
+
+		config.Entrypoint = nil
+		Expect(commandProbe(&appcorev1.CliAppSpec{UseImageEntrypoint: true}, config, nil)).To(BeNil())
+	})
+})
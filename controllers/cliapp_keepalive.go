@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"github.com/robfig/cron/v3"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"golang.org/x/xerrors"
+	"time"
+)
+
+var warmWindowParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// A window never lasts longer than a week, so looking back a week is enough to find the current one.
+const maxWarmWindowDuration = 7 * 24 * time.Hour
+
+func keepAlivePolicyOf(spec *appcorev1.CliAppSpec) appcorev1.CliAppKeepAlivePolicy {
+	if spec.KeepAlive == nil || len(spec.KeepAlive.Policy) == 0 {
+		return appcorev1.CliAppKeepAliveOnDemand
+	}
+
+	return spec.KeepAlive.Policy
+}
+
+func validateKeepAlive(spec *appcorev1.CliAppSpec) error {
+	if spec.KeepAlive == nil {
+		return nil
+	}
+
+	policy := keepAlivePolicyOf(spec)
+	switch policy {
+	case appcorev1.CliAppKeepAliveOnDemand, appcorev1.CliAppKeepAliveAlwaysOn, appcorev1.CliAppKeepAliveScheduled:
+	default:
+		return xerrors.Errorf("keep-alive policy must be one of %q, %q, or %q", appcorev1.CliAppKeepAliveOnDemand,
+			appcorev1.CliAppKeepAliveAlwaysOn, appcorev1.CliAppKeepAliveScheduled)
+	}
+
+	if policy != appcorev1.CliAppKeepAliveOnDemand && spec.UninstallUnlessLive {
+		return xerrors.Errorf("apps uninstalled unless Live can only be kept alive on demand")
+	}
+
+	if spec.KeepAlive.IdleTimeout != nil && spec.KeepAlive.IdleTimeout.Duration < 0 {
+		return xerrors.Errorf("idleTimeout can't be negative")
+	}
+
+	if policy == appcorev1.CliAppKeepAliveScheduled && len(spec.KeepAlive.WarmWindows) == 0 {
+		return xerrors.Errorf("specify at least one warm window for the Scheduled policy")
+	}
+
+	if policy != appcorev1.CliAppKeepAliveScheduled && len(spec.KeepAlive.WarmWindows) > 0 {
+		return xerrors.Errorf("warm windows only work with the Scheduled policy")
+	}
+
+	for _, w := range spec.KeepAlive.WarmWindows {
+		if _, err := warmWindowParser.Parse(w.Schedule); err != nil {
+			return xerrors.Errorf("invalid schedule %q of warm window: %s", w.Schedule, err)
+		}
+
+		if w.Duration.Duration <= 0 || w.Duration.Duration > maxWarmWindowDuration {
+			return xerrors.Errorf("duration of warm window %q must be positive and no longer than %s",
+				w.Schedule, maxWarmWindowDuration)
+		}
+	}
+
+	return nil
+}
+
+// inWarmWindow checks whether the time is in the window. It also returns the duration to the next time
+// the result changes.
+func inWarmWindow(w *appcorev1.CliAppWarmWindow, now time.Time) (bool, time.Duration, error) {
+	schedule, err := warmWindowParser.Parse(w.Schedule)
+	if err != nil {
+		return false, 0, xerrors.Errorf("invalid schedule %q of warm window: %s", w.Schedule, err)
+	}
+
+	// Find the latest start no later than now.
+	var lastStart time.Time
+	for start := schedule.Next(now.Add(-w.Duration.Duration)); !start.After(now); start = schedule.Next(start) {
+		lastStart = start
+	}
+
+	if !lastStart.IsZero() {
+		if end := lastStart.Add(w.Duration.Duration); end.After(now) {
+			return true, end.Sub(now), nil
+		}
+	}
+
+	return false, schedule.Next(now).Sub(now), nil
+}
+
+// keepAliveTarget figures out the phase the app should achieve by combining Spec.TargetPhase, which is set
+// by sessions, with the keep-alive policy. For scheduled apps, it also returns the duration to the next
+// window boundary, at which the app should be reconciled again.
+func keepAliveTarget(spec *appcorev1.CliAppSpec, now time.Time) (
+	target appcorev1.CliAppPhase, wakeAfter time.Duration, err error,
+) {
+	target = spec.TargetPhase
+	switch keepAlivePolicyOf(spec) {
+	case appcorev1.CliAppKeepAliveAlwaysOn:
+		target = appcorev1.CliAppPhaseLive
+	case appcorev1.CliAppKeepAliveScheduled:
+		for i := range spec.KeepAlive.WarmWindows {
+			in, next, err := inWarmWindow(&spec.KeepAlive.WarmWindows[i], now)
+			if err != nil {
+				return "", 0, err
+			}
+
+			if in {
+				target = appcorev1.CliAppPhaseLive
+			}
+
+			if wakeAfter == 0 || next < wakeAfter {
+				wakeAfter = next
+			}
+		}
+	}
+
+	return
+}
+
+// idleTimeout returns how long the app lasts after all its sessions closed.
+func (r *CliAppReconciler) idleTimeout(spec *appcorev1.CliAppSpec) time.Duration {
+	if spec.KeepAlive != nil && spec.KeepAlive.IdleTimeout != nil {
+		return spec.KeepAlive.IdleTimeout.Duration
+	}
+
+	return r.DurationIdleLiveLasts
+}
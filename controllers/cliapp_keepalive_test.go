@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
+)
+
+var _ = Describe("CliApp keep-alive", func() {
+	officeHours := &appcorev1.CliAppKeepAlive{
+		Policy: appcorev1.CliAppKeepAliveScheduled,
+		WarmWindows: []appcorev1.CliAppWarmWindow{
+			{Schedule: "CRON_TZ=UTC 0 9 * * 1-5", Duration: metav1.Duration{Duration: 8 * time.Hour}},
+		},
+	}
+
+	It("should keep scheduled apps Live in warm windows", func() {
+		spec := &appcorev1.CliAppSpec{TargetPhase: appcorev1.CliAppPhaseRest, KeepAlive: officeHours}
+		Expect(validateKeepAlive(spec)).To(Succeed())
+
+		// Monday 10:00 UTC
+		monday := time.Date(2021, 6, 7, 10, 0, 0, 0, time.UTC)
+		target, wakeAfter, err := keepAliveTarget(spec, monday)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(target).To(Equal(appcorev1.CliAppPhaseLive))
+		Expect(wakeAfter).To(Equal(7 * time.Hour))
+
+		// Monday 18:00 UTC
+		target, wakeAfter, err = keepAliveTarget(spec, monday.Add(8*time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(target).To(Equal(appcorev1.CliAppPhaseRest))
+		Expect(wakeAfter).To(Equal(15 * time.Hour))
+
+		// Saturday 10:00 UTC
+		target, wakeAfter, err = keepAliveTarget(spec, monday.Add(5*24*time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(target).To(Equal(appcorev1.CliAppPhaseRest))
+		Expect(wakeAfter).To(Equal(47 * time.Hour))
+	})
+
+	It("should keep sessions alive out of warm windows", func() {
+		spec := &appcorev1.CliAppSpec{TargetPhase: appcorev1.CliAppPhaseLive, KeepAlive: officeHours}
+		target, _, err := keepAliveTarget(spec, time.Date(2021, 6, 5, 10, 0, 0, 0, time.UTC))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(target).To(Equal(appcorev1.CliAppPhaseLive))
+	})
+
+	It("should keep AlwaysOn apps Live", func() {
+		spec := &appcorev1.CliAppSpec{
+			TargetPhase: appcorev1.CliAppPhaseRest,
+			KeepAlive:   &appcorev1.CliAppKeepAlive{Policy: appcorev1.CliAppKeepAliveAlwaysOn},
+		}
+		target, wakeAfter, err := keepAliveTarget(spec, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(target).To(Equal(appcorev1.CliAppPhaseLive))
+		Expect(wakeAfter).To(BeZero())
+	})
+
+	It("should override the idle timeout", func() {
+		r := &CliAppReconciler{DurationIdleLiveLasts: time.Hour}
+		Expect(r.idleTimeout(&appcorev1.CliAppSpec{})).To(Equal(time.Hour))
+		Expect(r.idleTimeout(&appcorev1.CliAppSpec{
+			KeepAlive: &appcorev1.CliAppKeepAlive{IdleTimeout: &metav1.Duration{}},
+		})).To(BeZero())
+	})
+
+	It("should reject invalid policies", func() {
+		for _, spec := range []appcorev1.CliAppSpec{
+			{KeepAlive: &appcorev1.CliAppKeepAlive{Policy: appcorev1.CliAppKeepAliveScheduled}},
+			{KeepAlive: &appcorev1.CliAppKeepAlive{Policy: appcorev1.CliAppKeepAliveAlwaysOn}, UninstallUnlessLive: true},
+			{KeepAlive: &appcorev1.CliAppKeepAlive{IdleTimeout: &metav1.Duration{Duration: -time.Second}}},
+			{KeepAlive: &appcorev1.CliAppKeepAlive{WarmWindows: officeHours.WarmWindows}},
+			{KeepAlive: &appcorev1.CliAppKeepAlive{
+				Policy:      appcorev1.CliAppKeepAliveScheduled,
+				WarmWindows: []appcorev1.CliAppWarmWindow{{Schedule: "0 9 * *", Duration: metav1.Duration{Duration: time.Hour}}},
+			}},
+			{KeepAlive: &appcorev1.CliAppKeepAlive{
+				Policy:      appcorev1.CliAppKeepAliveScheduled,
+				WarmWindows: []appcorev1.CliAppWarmWindow{{Schedule: "0 9 * * *"}},
+			}},
+		} {
+			Expect(validateKeepAlive(&spec)).NotTo(Succeed())
+		}
+	})
+
+	It("should not roll out Pods when sessions change TargetPhase", func() {
+		live := &appcorev1.CliAppSpec{Image: "busybox", TargetPhase: appcorev1.CliAppPhaseLive}
+		rest := &appcorev1.CliAppSpec{Image: "busybox", TargetPhase: appcorev1.CliAppPhaseRest, KeepAlive: officeHours}
+		Expect(computeHash(workloadSpec(rest))).To(Equal(computeHash(workloadSpec(live))))
+	})
+})
@@ -12,26 +12,25 @@ import (
 	"hash/fnv"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
 	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"strconv"
+	"time"
 )
 
 func (r *CliAppReconciler) makeAppLive(
 	ctx context.Context, log logr.Logger, app *appcorev1.CliApp,
 ) (result ctrl.Result, err error) {
-	if app.Spec.TargetPhase != appcorev1.CliAppPhaseLive {
-		panic(app.Name)
-	}
-
-	log.V(1).Info("app status", "current", app.Status.Phase, "target", app.Spec.TargetPhase)
+	log.V(1).Info("app status", "current", app.Status.Phase, "target", appcorev1.CliAppPhaseLive)
 
-	if app.Spec.Fork == nil && app.Status.Phase != appcorev1.CliAppPhaseBuilding && app.Spec.Image == "" {
+	if app.Status.Phase != appcorev1.CliAppPhaseBuilding && r.needBuild(app) {
 		log.V(1).Info("build image")
-		if app.Spec.Dockerfile == "" {
-			err = xerrors.Errorf("specify either image or dockerfile for the app")
+		if app.Spec.Dockerfile == "" && len(app.Spec.Packages) == 0 {
+			err = xerrors.Errorf("specify either image, dockerfile or packages for the app")
 			return
 		}
 
@@ -41,6 +40,8 @@ func (r *CliAppReconciler) makeAppLive(
 			return
 		}
 
+		setCondition(app, appcorev1.CliAppConditionImageReady, metav1.ConditionFalse, "Building",
+			"image is under build")
 		if err = r.transitPhaseTo(ctx, log, app, appcorev1.CliAppPhaseBuilding); err != nil {
 			return
 		}
@@ -49,20 +50,48 @@ func (r *CliAppReconciler) makeAppLive(
 		return
 	}
 
+	if app.Spec.Fork != nil {
+		setCondition(app, appcorev1.CliAppConditionImageReady, metav1.ConditionTrue, "Forked",
+			fmt.Sprintf("app forks %s", app.Spec.Fork.Object))
+	} else if len(app.Spec.Packages) > 0 {
+		setCondition(app, appcorev1.CliAppConditionImageReady, metav1.ConditionTrue, "Built",
+			fmt.Sprintf("image %s is built with packages", app.Spec.Image))
+	} else if len(app.Spec.Image) > 0 {
+		setCondition(app, appcorev1.CliAppConditionImageReady, metav1.ConditionTrue, "ImageSpecified",
+			fmt.Sprintf("app uses image %s", app.Spec.Image))
+	}
+
 	switch app.Status.Phase {
 	case "", appcorev1.CliAppPhaseShuttingDown, appcorev1.CliAppPhaseWaitingForSessions, appcorev1.CliAppPhaseRest:
+		if r.isFailed(app) {
+			err = r.transitPhaseTo(ctx, log, app, appcorev1.CliAppPhaseFailed)
+			return
+		}
+
+		err = r.transitPhaseTo(ctx, log, app, appcorev1.CliAppPhaseRecovering)
+		result.Requeue = true
+		return
+	case appcorev1.CliAppPhaseFailed:
+		if r.isFailed(app) {
+			log.Info("app failed", "reason", app.Status.Failure.Reason)
+			return
+		}
+
 		err = r.transitPhaseTo(ctx, log, app, appcorev1.CliAppPhaseRecovering)
 		result.Requeue = true
 		return
 	case appcorev1.CliAppPhaseLive:
-		specHash := computeHash(&app.Spec)
-		specDump := encodeSpec(&app.Spec)
+		spec := workloadSpec(&app.Spec)
+		specHash := computePodHash(spec, app.Status.PinnedImages)
+		specDump := encodeSpec(spec)
 		var newPod *corev1.Pod
-		newPod, err = r.claimPods(ctx, log, app, specDump, specHash)
+		newPod, result.RequeueAfter, err = r.claimPods(ctx, log, app, specDump, specHash)
 		if err != nil {
 			return
 		}
 
+		setPodConditions(app, newPod)
+
 		if newPod != nil && utils.IsPodReady(newPod) {
 			if app.Status.PodName != newPod.Name {
 				app.Status.PodName = newPod.Name
@@ -83,40 +112,86 @@ func (r *CliAppReconciler) makeAppLive(
 		return
 
 	case appcorev1.CliAppPhaseRecovering:
-		specHash := computeHash(&app.Spec)
-		specDump := encodeSpec(&app.Spec)
+		spec := workloadSpec(&app.Spec)
+		specHash := computePodHash(spec, app.Status.PinnedImages)
+		specDump := encodeSpec(spec)
 		var newPod *corev1.Pod
-		newPod, err = r.claimPods(ctx, log, app, specDump, specHash)
+		newPod, result.RequeueAfter, err = r.claimPods(ctx, log, app, specDump, specHash)
 		if err != nil {
 			return
 		}
 
+		setPodConditions(app, newPod)
+
 		if newPod != nil {
 			if utils.IsPodReady(newPod) {
 				app.Status.PodName = newPod.Name
+				app.Status.Failure = nil
 				if err = r.transitPhaseTo(ctx, log, app, appcorev1.CliAppPhaseLive); err != nil {
 					return
 				}
 				return
 			}
 
+			if reason, message := r.diagnosePod(ctx, log, newPod); len(reason) > 0 {
+				log.Info("pod failed to start", "pod", newPod.Name, "reason", reason)
+				if err = r.Delete(ctx, newPod); err != nil {
+					log.Error(err, "unable to delete failed pod", "pod", newPod.Name)
+					return
+				}
+
+				return r.recordFailure(ctx, log, app, reason, message)
+			}
+
 			log.Info("wait for pod to be ready", "pod", newPod.Name)
+			if _, left := r.unschedulableGraceLeft(newPod); left > 0 {
+				result.RequeueAfter = left
+			}
+
+			return
+		}
+
+		if wait := r.waitForRetry(app); wait > 0 {
+			log.Info("wait for the next retry", "after", wait)
+			result.RequeueAfter = wait
 			return
 		}
 
 		log.Info("create pod")
-		_, err = r.startApp(ctx, app, log, specDump, specHash)
-		return result, err
+		if _, err = r.startApp(ctx, app, log, specDump, specHash); err != nil {
+			reason := "StartFailed"
+			if profileErr := (*securityProfileError)(nil); xerrors.As(err, &profileErr) {
+				reason = securityProfileViolatedReason
+			}
+
+			result, _ = r.recordFailure(ctx, log, app, reason, err.Error())
+			return result, err
+		}
+
+		return
 
 	case appcorev1.CliAppPhaseBuilding:
-		if len(app.Spec.Image) == 0 {
+		if r.needBuild(app) {
 			log.Info("build image")
-			image, err := r.testImage(log, app)
+			image, dockerfile, args, err := r.imageToBuild(app)
 			if err != nil {
+				setCondition(app, appcorev1.CliAppConditionImageReady, metav1.ConditionFalse, "BuildFailed",
+					err.Error())
+				return result, err
+			}
+
+			image, output, err := r.testImage(log, app, image, dockerfile, args)
+			if err == underBuild {
 				result.RequeueAfter = DefaultRequeueDuration
 				return result, nil
 			}
 
+			if err != nil {
+				setCondition(app, appcorev1.CliAppConditionImageReady, metav1.ConditionFalse, "BuildFailed",
+					err.Error())
+				return result, err
+			}
+
 			err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
 				app.Spec.Image = image
 				return r.Update(ctx, app)
@@ -126,6 +201,19 @@ func (r *CliAppReconciler) makeAppLive(
 				result.RequeueAfter = DefaultRequeueDuration
 				return result, err
 			}
+
+			app.Status.Packages = nil
+			if len(app.Spec.Packages) > 0 {
+				packages := sortedPackages(app.Spec.Packages)
+				app.Status.Packages = &appcorev1.CliAppPackagesStatus{
+					Distro:    r.packageDistroOf(&app.Spec),
+					Requested: packages,
+					Installed: parsePackageVersions(packages, output),
+				}
+			}
+
+			setCondition(app, appcorev1.CliAppConditionImageReady, metav1.ConditionTrue, "Built",
+				fmt.Sprintf("image %s is built", image))
 		}
 
 		if err = r.transitPhaseTo(ctx, log, app, appcorev1.CliAppPhaseRecovering); err != nil {
@@ -139,6 +227,20 @@ func (r *CliAppReconciler) makeAppLive(
 	}
 }
 
+// workloadSpec returns a copy of the spec without fields which don't affect the app Pod, such as TargetPhase
+// changed along with sessions, so that changing them won't roll out the Pod.
+func workloadSpec(spec *appcorev1.CliAppSpec) *appcorev1.CliAppSpec {
+	spec = spec.DeepCopy()
+	spec.TargetPhase = appcorev1.CliAppPhaseLive
+	spec.UninstallUnlessLive = false
+	spec.Rollout = nil
+	spec.KeepAlive = nil
+	spec.ImagePolicy = nil
+	spec.PrePull = false
+	spec.ShellHistory = nil
+	return spec
+}
+
 func computeHash(spec *appcorev1.CliAppSpec) string {
 	podTemplateSpecHasher := fnv.New32a()
 	deepHashObject(podTemplateSpecHasher, *spec)
@@ -167,13 +269,8 @@ func deepHashObject(hasher hash.Hash, objectToWrite interface{}) {
 
 func (r *CliAppReconciler) claimPods(
 	ctx context.Context, log logr.Logger, app *appcorev1.CliApp, specDump, specHash string,
-) (pod *corev1.Pod, err error) {
-	config, err := r.RestClient.ToRESTConfig()
-	if err != nil {
-		panic(err)
-	}
-
-	clientset, err := kubernetes.NewForConfig(config)
+) (pod *corev1.Pod, requeueAfter time.Duration, err error) {
+	clientset, err := r.kubeClient()
 	if err != nil {
 		return
 	}
@@ -194,14 +291,7 @@ func (r *CliAppReconciler) claimPods(
 			continue
 		}
 
-		if len(pod.Annotations) == 0 ||
-			pod.Annotations[annoKeySpecHash] != specHash ||
-			pod.Annotations[annoKeySpecDump] == "" {
-
-			oldPods = append(oldPods, pod)
-		}
-
-		if pod.Annotations[annoKeySpecDump] != specDump {
+		if pod.Annotations[annoKeySpecHash] != specHash || pod.Annotations[annoKeySpecDump] != specDump {
 			oldPods = append(oldPods, pod)
 		} else {
 			newPods = append(newPods, pod)
@@ -214,10 +304,19 @@ func (r *CliAppReconciler) claimPods(
 		oldPods = append(oldPods, newPods[1:]...)
 	}
 
+	app.Status.RetiringPods = nil
 	for _, pod := range oldPods {
-		log.Info("recycle old pod", "pod", pod.Name)
-		if err := clientset.CoreV1().Pods(app.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil {
+		gracePeriod, err := r.retirePod(ctx, log, clientset, app, pod)
+		if err != nil {
 			log.Error(err, "unable to delete old pod", "pod", pod.Name)
+			continue
+		}
+
+		if gracePeriod > 0 {
+			app.Status.RetiringPods = append(app.Status.RetiringPods, pod.Name)
+			if requeueAfter == 0 || gracePeriod < requeueAfter {
+				requeueAfter = gracePeriod
+			}
 		}
 	}
 
@@ -227,3 +326,71 @@ func (r *CliAppReconciler) claimPods(
 
 	return
 }
+
+// retirePod deletes the outdated Pod unless it is still serving sessions in the grace period.
+// The remaining grace period is returned if the Pod is kept.
+func (r *CliAppReconciler) retirePod(
+	ctx context.Context, log logr.Logger, clientset kubernetes.Interface, app *appcorev1.CliApp, pod *corev1.Pod,
+) (time.Duration, error) {
+	strategy := appcorev1.CliAppRolloutGraceful
+	gracePeriod := r.RolloutGracePeriod
+	if app.Spec.Rollout != nil {
+		if len(app.Spec.Rollout.Strategy) > 0 {
+			strategy = app.Spec.Rollout.Strategy
+		}
+
+		if app.Spec.Rollout.GracePeriod != nil {
+			gracePeriod = app.Spec.Rollout.GracePeriod.Duration
+		}
+	}
+
+	if sessions, leaseExpiry := liveSessionsOf(pod); sessions > 0 && strategy == appcorev1.CliAppRolloutGraceful {
+		retiredAt, err := time.Parse(time.RFC3339, pod.Annotations[annoKeyRetiredAt])
+		if err != nil {
+			retiredAt = time.Now()
+			patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`,
+				annoKeyRetiredAt, retiredAt.Format(time.RFC3339))
+			_, err = clientset.CoreV1().Pods(pod.Namespace).Patch(
+				ctx, pod.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{},
+			)
+			if err != nil {
+				return 0, err
+			}
+
+			log.Info("outdated pod is retiring", "pod", pod.Name, "sessions", sessions, "gracePeriod", gracePeriod)
+		}
+
+		if remaining := time.Until(retiredAt.Add(gracePeriod)); remaining > 0 {
+			if leaseExpiry < remaining {
+				remaining = leaseExpiry
+			}
+
+			return remaining, nil
+		}
+
+		log.Info("grace period of outdated pod passed", "pod", pod.Name, "sessions", sessions)
+	}
+
+	log.Info("recycle old pod", "pod", pod.Name)
+	return 0, clientset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+}
+
+// The session gate renews the session count of Pods every minute while sessions are open.
+const sessionLeaseDuration = 3 * time.Minute
+
+// liveSessionsOf returns the number of sessions the session gate counts on the Pod, and the duration after which
+// the count expires if the gate doesn't renew it. Counts not renewed in time are left by crashed gates and ignored.
+func liveSessionsOf(pod *corev1.Pod) (int, time.Duration) {
+	renewedAt, err := time.Parse(time.RFC3339, pod.Annotations[annoKeySessionsRenewed])
+	if err != nil {
+		return 0, 0
+	}
+
+	leaseExpiry := time.Until(renewedAt.Add(sessionLeaseDuration))
+	if leaseExpiry <= 0 {
+		return 0, 0
+	}
+
+	sessions, _ := strconv.Atoi(pod.Annotations[annoKeySessions])
+	return sessions, leaseExpiry
+}
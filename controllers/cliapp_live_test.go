@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"strconv"
+	"time"
+)
+
+var _ = Describe("CliApp rollout", func() {
+	r := &CliAppReconciler{RolloutGracePeriod: DefaultRolloutGrace}
+	app := &appcorev1.CliApp{}
+
+	newPod := func(sessions int, renewedAt time.Time) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "app-old",
+			Annotations: map[string]string{
+				annoKeySessions:        strconv.Itoa(sessions),
+				annoKeySessionsRenewed: renewedAt.UTC().Format(time.RFC3339),
+			},
+		}}
+	}
+
+	retire := func(pod *corev1.Pod) (time.Duration, bool) {
+		clientset := fake.NewSimpleClientset(pod)
+		gracePeriod, err := r.retirePod(context.TODO(), ctrl.Log, clientset, app, pod)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = clientset.CoreV1().Pods(pod.Namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return gracePeriod, false
+		}
+
+		Expect(err).NotTo(HaveOccurred())
+		return gracePeriod, true
+	}
+
+	It("should delete outdated Pods without sessions", func() {
+		gracePeriod, kept := retire(newPod(0, time.Now()))
+		Expect(kept).To(BeFalse())
+		Expect(gracePeriod).To(BeZero())
+	})
+
+	It("should keep outdated Pods serving sessions until the lease expires", func() {
+		gracePeriod, kept := retire(newPod(1, time.Now()))
+		Expect(kept).To(BeTrue())
+		Expect(gracePeriod).To(BeNumerically(">", 0))
+		Expect(gracePeriod).To(BeNumerically("<=", sessionLeaseDuration))
+	})
+
+	It("should delete outdated Pods once the grace period passed", func() {
+		pod := newPod(1, time.Now())
+		pod.Annotations[annoKeyRetiredAt] = time.Now().Add(-2 * DefaultRolloutGrace).UTC().Format(time.RFC3339)
+		_, kept := retire(pod)
+		Expect(kept).To(BeFalse())
+	})
+
+	It("should ignore sessions the gate no longer renews", func() {
+		_, kept := retire(newPod(1, time.Now().Add(-2*sessionLeaseDuration)))
+		Expect(kept).To(BeFalse())
+
+		pod := newPod(1, time.Now())
+		delete(pod.Annotations, annoKeySessionsRenewed)
+		_, kept = retire(pod)
+		Expect(kept).To(BeFalse())
+	})
+
+	It("should delete outdated Pods immediately if the strategy is Recreate", func() {
+		recreate := app.DeepCopy()
+		recreate.Spec.Rollout = &appcorev1.CliAppRollout{Strategy: appcorev1.CliAppRolloutRecreate}
+		clientset := fake.NewSimpleClientset(newPod(1, time.Now()))
+		gracePeriod, err := r.retirePod(context.TODO(), ctrl.Log, clientset, recreate, newPod(1, time.Now()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gracePeriod).To(BeZero())
+	})
+})
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	"path/filepath"
+)
+
+const (
+	nativeToolsContainer = "tools"
+	nativeToolsVolume    = "cliapp-tools"
+	nativeToolsDir       = "/.cliapp"
+
+	// busybox the native tools image provides.
+	toolsImageBusybox = "/bin/busybox"
+)
+
+var (
+	DefaultNativeToolsImage = "docker.io/library/busybox:musl"
+
+	// busybox copied from the tools image. It is statically linked so that it runs in any app image.
+	nativeBusybox = filepath.Join(nativeToolsDir, "busybox")
+)
+
+func isNativeMode(spec *appcorev1.CliAppSpec) bool {
+	return spec.ExecutionMode == appcorev1.CliAppExecutionModeNative
+}
+
+func ValidateExecutionMode(m appcorev1.CliAppExecutionMode) error {
+	switch m {
+	case appcorev1.CliAppExecutionModeChroot, appcorev1.CliAppExecutionModeNative:
+		return nil
+	default:
+		return xerrors.Errorf("Spec.ExecutionMode must be either %q or %q",
+			appcorev1.CliAppExecutionModeChroot, appcorev1.CliAppExecutionModeNative)
+	}
+}
+
+func (r *CliAppReconciler) nativeToolsImage() string {
+	if len(r.NativeToolsImage) == 0 {
+		return r.rewriteImage(DefaultNativeToolsImage)
+	}
+
+	return r.rewriteImage(r.NativeToolsImage)
+}
+
+// installNativeTools keeps the workspace container alive with busybox copied by an init container,
+// instead of the entrypoint of the app image.
+func (r *CliAppReconciler) installNativeTools(pod *corev1.Pod, container *corev1.Container) {
+	mount := corev1.VolumeMount{
+		Name:      nativeToolsVolume,
+		MountPath: nativeToolsDir,
+	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name:         nativeToolsVolume,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{
+		Name:         nativeToolsContainer,
+		Image:        r.nativeToolsImage(),
+		Command:      []string{"cp", toolsImageBusybox, nativeBusybox},
+		VolumeMounts: []corev1.VolumeMount{mount},
+	})
+
+	mount.ReadOnly = true
+	container.VolumeMounts = append(container.VolumeMounts, mount)
+	container.Command = []string{nativeBusybox, "sleep", "2147483647"}
+	container.Args = nil
+}
@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("CliApp native mode", func() {
+	It("should keep the app container alive with busybox", func() {
+		r := &CliAppReconciler{ImagePrefixRewrites: map[string]string{"docker.io/library/": "registry.local/"}}
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: appContainer, Image: "tools/kubectl", Args: []string{"version"},
+		}}}}
+		container := &pod.Spec.Containers[0]
+		r.installNativeTools(pod, container)
+		Expect(pod.Spec.InitContainers[0].Image).To(Equal("registry.local/busybox:musl"))
+		Expect(pod.Spec.Volumes[0].EmptyDir).NotTo(BeNil())
+		Expect(container.Image).To(Equal("tools/kubectl"))
+		Expect(container.Command).To(Equal([]string{nativeBusybox, "sleep", "2147483647"}))
+		Expect(container.Args).To(BeEmpty())
+		Expect(container.VolumeMounts[0].ReadOnly).To(BeTrue())
+	})
+
+	It("should probe commands in the app image", func() {
+		spec := &appcorev1.CliAppSpec{Command: []string{"kubectl"}, ExecutionMode: appcorev1.CliAppExecutionModeNative}
+		probe := commandProbe(spec, &imageConfiguration{}, nil)
+		Expect(probe.Exec.Command[:3]).To(Equal([]string{nativeBusybox, "sh", "-c"}))
+		Expect(probe.Exec.Command[3]).To(ContainSubstring("'/usr/bin/kubectl'"))
+		Expect(probe.Exec.Command[3]).NotTo(ContainSubstring(appRoot))
+	})
+})
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"bufio"
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"golang.org/x/xerrors"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// The image built from Spec.Packages. The tag is the hash of packages, so that Pods are rolled out on rebuild.
+	builtPackagesImage = "docker.io/warmmetal/%s:packages-%s"
+
+	// prefix of lines the build prints for each installed package, in the form of "prefix name version".
+	packageVersionPrefix = "cliapp-package"
+
+	// build argument changed on every build, so that the step printing package versions always runs.
+	packageBuildIDArg = "CLIAPP_BUILD_ID"
+)
+
+// A package name with an optional version pinned, such as "jq" or "jq=1.6-r1".
+var packagePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.+_-]*(=[a-zA-Z0-9.+~:_-]+)?$`)
+
+func validatePackages(app *appcorev1.CliApp) error {
+	spec := &app.Spec
+	if len(spec.Packages) == 0 {
+		return nil
+	}
+
+	if len(spec.Dockerfile) > 0 {
+		return xerrors.Errorf("only one of Dockerfile or Packages can be set")
+	}
+
+	// Image is set by the controller once packages are built.
+	if len(spec.Image) > 0 && !isBuiltPackagesImage(app.Name, spec.Image) {
+		return xerrors.Errorf("only one of Image or Packages can be set")
+	}
+
+	if spec.Fork != nil {
+		return xerrors.Errorf("Packages can't be set along with Fork")
+	}
+
+	for _, pkg := range spec.Packages {
+		if !packagePattern.MatchString(pkg) {
+			return xerrors.Errorf("invalid package %q", pkg)
+		}
+	}
+
+	return nil
+}
+
+// isBuiltPackagesImage checks whether the image is one the controller built from packages for the app.
+func isBuiltPackagesImage(app, image string) bool {
+	pattern := fmt.Sprintf(`/%s:packages-[0-9a-f]{8}$`, regexp.QuoteMeta(app))
+	matched, err := regexp.MatchString(pattern, image)
+	return err == nil && matched
+}
+
+// packageNameOf returns the package name without the pinned version.
+func packageNameOf(pkg string) string {
+	return strings.SplitN(pkg, "=", 2)[0]
+}
+
+// sortedPackages returns sorted and deduplicated packages.
+func sortedPackages(packages []string) []string {
+	sorted := make([]string, 0, len(packages))
+	found := make(map[string]bool, len(packages))
+	for _, pkg := range packages {
+		if !found[pkg] {
+			found[pkg] = true
+			sorted = append(sorted, pkg)
+		}
+	}
+
+	sort.Strings(sorted)
+	return sorted
+}
+
+// packageDistroOf returns the distro packages are installed on.
+func (r *CliAppReconciler) packageDistroOf(spec *appcorev1.CliAppSpec) appcorev1.CliAppDistro {
+	if len(spec.Distro) > 0 {
+		return spec.Distro
+	}
+
+	if len(r.DefaultDistro) > 0 {
+		return r.DefaultDistro
+	}
+
+	return appcorev1.CliAppDistroAlpine
+}
+
+// packagesDockerfile generates the Dockerfile installing packages on the base image by the package manager.
+// The last step prints versions of installed packages.
+func packagesDockerfile(packageManager, baseImage string, packages []string) (string, error) {
+	names := make([]string, len(packages))
+	for i := range packages {
+		names[i] = packageNameOf(packages[i])
+	}
+
+	var install, list string
+	switch packageManager {
+	case packageManagerApk:
+		install = fmt.Sprintf("apk add --no-cache %s", strings.Join(packages, " "))
+		list = fmt.Sprintf(`awk -F: '$1 == "P" {p = $2} $1 == "V" {print "%s", p, $2}' /lib/apk/db/installed`,
+			packageVersionPrefix)
+	case packageManagerApt:
+		install = fmt.Sprintf(
+			"apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends %s && "+
+				"rm -rf /var/lib/apt/lists/*",
+			strings.Join(packages, " "),
+		)
+		list = fmt.Sprintf(`dpkg-query -W -f='%s ${Package} ${Version}\n' %s`, packageVersionPrefix,
+			strings.Join(names, " "))
+	case packageManagerDnf:
+		// dnf pins versions in the form of "name-version".
+		pinned := make([]string, len(packages))
+		for i := range packages {
+			pinned[i] = strings.Replace(packages[i], "=", "-", 1)
+		}
+
+		install = fmt.Sprintf("dnf install -y %s && dnf clean all", strings.Join(pinned, " "))
+		list = fmt.Sprintf(`rpm -q --qf '%s %%{NAME} %%{VERSION}-%%{RELEASE}\n' %s`, packageVersionPrefix,
+			strings.Join(names, " "))
+	case packageManagerPacman:
+		for _, pkg := range packages {
+			if pkg != packageNameOf(pkg) {
+				return "", xerrors.Errorf("pacman doesn't support pinned versions like %q", pkg)
+			}
+		}
+
+		install = fmt.Sprintf("pacman -Sy --noconfirm %s && pacman -Scc --noconfirm", strings.Join(packages, " "))
+		list = fmt.Sprintf(`pacman -Q %s | sed 's/^/%s /'`, strings.Join(names, " "), packageVersionPrefix)
+	default:
+		return "", xerrors.Errorf("package manager %q is not supported", packageManager)
+	}
+
+	return fmt.Sprintf("FROM %s\nRUN %s\nARG %s\nRUN %s\n", baseImage, install, packageBuildIDArg, list), nil
+}
+
+// packagesHash returns the hash of the distro and packages.
+func packagesHash(distro appcorev1.CliAppDistro, packages []string) string {
+	h := fnv.New32a()
+	h.Write([]byte(distro))
+	for _, pkg := range packages {
+		h.Write([]byte{0})
+		h.Write([]byte(pkg))
+	}
+
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// packagesOutdated checks whether the image should be built or rebuilt since packages or the distro changed.
+func (r *CliAppReconciler) packagesOutdated(app *appcorev1.CliApp) bool {
+	if len(app.Spec.Packages) == 0 {
+		return false
+	}
+
+	status := app.Status.Packages
+	if len(app.Spec.Image) == 0 || status == nil {
+		return true
+	}
+
+	return status.Distro != r.packageDistroOf(&app.Spec) ||
+		strings.Join(status.Requested, " ") != strings.Join(sortedPackages(app.Spec.Packages), " ")
+}
+
+// needBuild checks whether the app image should be built.
+func (r *CliAppReconciler) needBuild(app *appcorev1.CliApp) bool {
+	return app.Spec.Fork == nil && (len(app.Spec.Image) == 0 || r.packagesOutdated(app))
+}
+
+// imageToBuild returns the image name, the Dockerfile and build arguments to build the app image.
+func (r *CliAppReconciler) imageToBuild(app *appcorev1.CliApp) (image, dockerfile string, args map[string]string,
+	err error) {
+	if len(app.Spec.Packages) == 0 {
+		return r.rewriteImage(fmt.Sprintf(builtImage, app.Name)), app.Spec.Dockerfile, nil, nil
+	}
+
+	distro := r.packageDistroOf(&app.Spec)
+	distroCtx, found := r.distros()[distro]
+	if !found || len(distroCtx.BaseImage) == 0 || len(distroCtx.PackageManager) == 0 {
+		err = xerrors.Errorf("packages are not supported on distro %s", distro)
+		return
+	}
+
+	packages := sortedPackages(app.Spec.Packages)
+	dockerfile, err = packagesDockerfile(distroCtx.PackageManager, r.rewriteImage(distroCtx.BaseImage), packages)
+	if err != nil {
+		return
+	}
+
+	image = r.rewriteImage(fmt.Sprintf(builtPackagesImage, app.Name, packagesHash(distro, packages)))
+	args = map[string]string{packageBuildIDArg: time.Now().UTC().Format(time.RFC3339Nano)}
+	return
+}
+
+// parsePackageVersions parses versions of requested packages from the build output.
+func parsePackageVersions(packages []string, output string) []appcorev1.CliAppPackage {
+	requested := make(map[string]bool, len(packages))
+	for _, pkg := range packages {
+		requested[packageNameOf(pkg)] = true
+	}
+
+	versions := make(map[string]string, len(packages))
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[0] != packageVersionPrefix || !requested[fields[1]] {
+			continue
+		}
+
+		versions[fields[1]] = fields[2]
+	}
+
+	installed := make([]appcorev1.CliAppPackage, 0, len(versions))
+	for name, version := range versions {
+		installed = append(installed, appcorev1.CliAppPackage{Name: name, Version: version})
+	}
+
+	sort.Slice(installed, func(i, j int) bool {
+		return installed[i].Name < installed[j].Name
+	})
+
+	return installed
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+)
+
+var _ = Describe("CliApp packages", func() {
+	r := &CliAppReconciler{}
+
+	It("should validate packages", func() {
+		validate := func(spec appcorev1.CliAppSpec) error {
+			app := &appcorev1.CliApp{Spec: spec}
+			app.Name = "jq"
+			return validatePackages(app)
+		}
+
+		Expect(validate(appcorev1.CliAppSpec{Packages: []string{"jq", "postgresql-client", "curl=7.74.0-r1"}})).
+			To(Succeed())
+		Expect(validate(appcorev1.CliAppSpec{Packages: []string{"jq; rm -rf /"}})).NotTo(Succeed())
+		Expect(validate(appcorev1.CliAppSpec{Packages: []string{"jq"}, Dockerfile: "FROM alpine"})).
+			NotTo(Succeed())
+		Expect(validate(appcorev1.CliAppSpec{Packages: []string{"jq"}, Image: "alpine:3"})).NotTo(Succeed())
+
+		image, _, _, err := r.imageToBuild(&appcorev1.CliApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "jq"},
+			Spec:       appcorev1.CliAppSpec{Packages: []string{"jq"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(validate(appcorev1.CliAppSpec{Packages: []string{"jq"}, Image: image})).To(Succeed())
+	})
+
+	It("should generate Dockerfiles for distros", func() {
+		dockerfile, err := packagesDockerfile(packageManagerApk, "alpine:latest", []string{"curl=7.74.0-r1", "jq"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dockerfile).
+			To(HavePrefix("FROM alpine:latest\nRUN apk add --no-cache curl=7.74.0-r1 jq\nARG CLIAPP_BUILD_ID\n"))
+		Expect(dockerfile).To(ContainSubstring("/lib/apk/db/installed"))
+
+		dockerfile, err = packagesDockerfile(packageManagerApt, "ubuntu:latest", []string{"curl=7.68.0", "jq"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dockerfile).To(ContainSubstring("apt-get install -y --no-install-recommends curl=7.68.0 jq"))
+		Expect(dockerfile).To(ContainSubstring(`${Version}\n' curl jq`))
+	})
+
+	It("should parse versions of requested packages", func() {
+		output := strings.Join([]string{
+			"#5 0.123 cliapp-package musl 1.2.2-r0",
+			"cliapp-package jq 1.6-r1",
+			"cliapp-package curl 7.74.0-r1",
+			"fetch https://dl-cdn.alpinelinux.org/alpine/v3.13/main/x86_64/APKINDEX.tar.gz",
+		}, "\n")
+		Expect(parsePackageVersions([]string{"jq", "curl=7.74.0-r1"}, output)).To(Equal([]appcorev1.CliAppPackage{
+			{Name: "curl", Version: "7.74.0-r1"},
+			{Name: "jq", Version: "1.6-r1"},
+		}))
+	})
+
+	It("should rebuild images once packages change", func() {
+		app := &appcorev1.CliApp{Spec: appcorev1.CliAppSpec{Packages: []string{"jq", "curl"}}}
+		Expect(r.needBuild(app)).To(BeTrue())
+
+		app.Spec.Image = "docker.io/warmmetal/app:packages-0"
+		app.Status.Packages = &appcorev1.CliAppPackagesStatus{
+			Distro:    appcorev1.CliAppDistroAlpine,
+			Requested: []string{"curl", "jq"},
+		}
+		Expect(r.needBuild(app)).To(BeFalse())
+
+		app.Spec.Packages = append(app.Spec.Packages, "git")
+		Expect(r.needBuild(app)).To(BeTrue())
+
+		app.Spec.Packages = []string{"curl", "jq"}
+		app.Spec.Distro = appcorev1.CliAppDistroUbuntu
+		Expect(r.needBuild(app)).To(BeTrue())
+	})
+
+	It("should tag images with the hash of packages", func() {
+		app := &appcorev1.CliApp{Spec: appcorev1.CliAppSpec{Packages: []string{"jq"}}}
+		app.Name = "tools"
+		image, _, args, err := r.imageToBuild(app)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(image).To(HavePrefix("docker.io/warmmetal/tools:packages-"))
+		Expect(args).To(HaveKey(packageBuildIDArg))
+
+		app.Spec.Packages = []string{"jq", "curl"}
+		rebuilt, _, _, err := r.imageToBuild(app)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rebuilt).NotTo(Equal(image))
+	})
+})
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+func validatePodTemplate(spec *appcorev1.CliAppSpec) error {
+	if spec.PodTemplate == nil || len(spec.PodTemplate.Raw) == 0 {
+		return nil
+	}
+
+	patch := make(map[string]interface{})
+	if err := json.Unmarshal(spec.PodTemplate.Raw, &patch); err != nil {
+		return xerrors.Errorf("podTemplate must be a partial Pod manifest: %s", err)
+	}
+
+	// Apply the template to a skeleton of the rendered Pod, so that invalid fields and changes the app depends on
+	// are refused before any Pod is rendered.
+	app := &appcorev1.CliApp{Spec: *spec}
+	app.Name = "template"
+	app.UID = "template"
+	skeleton := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            app.Name,
+			Namespace:       app.Name,
+			Labels:          map[string]string{appLabel: app.Name},
+			OwnerReferences: []metav1.OwnerReference{{Name: app.Name, UID: app.UID, Controller: &enabled}},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: appContainer, Image: app.Name}},
+		},
+	}
+
+	if !isNativeMode(spec) {
+		skeleton.Spec.Volumes = []corev1.Volume{{Name: appImageVolume}}
+		skeleton.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{Name: appImageVolume, MountPath: appRoot}}
+	}
+
+	_, err := applyPodTemplate(skeleton, app)
+	return err
+}
+
+// applyPodTemplate applies Spec.PodTemplate to the rendered Pod as a strategic merge patch.
+func applyPodTemplate(pod *corev1.Pod, app *appcorev1.CliApp) (*corev1.Pod, error) {
+	if app.Spec.PodTemplate == nil || len(app.Spec.PodTemplate.Raw) == 0 {
+		return pod, nil
+	}
+
+	patchedPod, err := mergePodTemplate(pod, app)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = validatePatchedPod(patchedPod, pod, app); err != nil {
+		return nil, err
+	}
+
+	return patchedPod, nil
+}
+
+// mergePodTemplate merges Spec.PodTemplate into a copy of the Pod without validating the result. It is used to
+// read fields the template could set, such as the service account, before the Pod is rendered.
+func mergePodTemplate(pod *corev1.Pod, app *appcorev1.CliApp) (*corev1.Pod, error) {
+	if app.Spec.PodTemplate == nil || len(app.Spec.PodTemplate.Raw) == 0 {
+		return pod, nil
+	}
+
+	original, err := json.Marshal(pod)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to encode pod: %s", err)
+	}
+
+	patched, err := strategicpatch.StrategicMergePatch(original, app.Spec.PodTemplate.Raw, &corev1.Pod{})
+	if err != nil {
+		return nil, xerrors.Errorf("unable to apply podTemplate: %s", err)
+	}
+
+	patchedPod := &corev1.Pod{}
+	if err = json.Unmarshal(patched, patchedPod); err != nil {
+		return nil, xerrors.Errorf("unable to decode the patched pod: %s", err)
+	}
+
+	return patchedPod, nil
+}
+
+func validatePatchedPod(patched, original *corev1.Pod, app *appcorev1.CliApp) error {
+	if patched.Name != original.Name || patched.Namespace != original.Namespace {
+		return xerrors.Errorf("podTemplate can't change name or namespace of the Pod")
+	}
+
+	if patched.Labels[appLabel] != app.Name {
+		return xerrors.Errorf("podTemplate can't change label %q of the Pod", appLabel)
+	}
+
+	ownerFound := false
+	for _, ref := range patched.OwnerReferences {
+		if ref.UID == app.UID && ref.Controller != nil && *ref.Controller {
+			ownerFound = true
+			break
+		}
+	}
+
+	if !ownerFound {
+		return xerrors.Errorf("podTemplate can't remove the owner reference of the Pod")
+	}
+
+	container := workspaceContainerOf(patched)
+	if container == nil {
+		return xerrors.Errorf("podTemplate can't remove the container %q", appContainer)
+	}
+
+	if originalContainer := workspaceContainerOf(original); originalContainer != nil &&
+		container.Image != originalContainer.Image {
+		return xerrors.Errorf("podTemplate can't change the image of the container %q", appContainer)
+	}
+
+	if !hasVolume(original, appImageVolume) {
+		return nil
+	}
+
+	if !hasVolume(patched, appImageVolume) {
+		return xerrors.Errorf("podTemplate can't remove the volume %q", appImageVolume)
+	}
+
+	if !mountsVolume(container, appImageVolume, appRoot) {
+		return xerrors.Errorf("podTemplate can't change the mount of volume %q at %q", appImageVolume, appRoot)
+	}
+
+	return nil
+}
+
+func mountsVolume(container *corev1.Container, name, mountPath string) bool {
+	for i := range container.VolumeMounts {
+		if container.VolumeMounts[i].Name == name && container.VolumeMounts[i].MountPath == mountPath {
+			return true
+		}
+	}
+
+	return false
+}
+
+func workspaceContainerOf(pod *corev1.Pod) *corev1.Container {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == appContainer {
+			return &pod.Spec.Containers[i]
+		}
+	}
+
+	return nil
+}
+
+func hasVolume(pod *corev1.Pod, name string) bool {
+	for i := range pod.Spec.Volumes {
+		if pod.Spec.Volumes[i].Name == name {
+			return true
+		}
+	}
+
+	return false
+}
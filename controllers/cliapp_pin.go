@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"hash/fnv"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"time"
+)
+
+// pinnedImageOf returns the digest of the image if it is pinned, or the image itself.
+func pinnedImageOf(image string, pins *appcorev1.CliAppPinnedImages) string {
+	if pins == nil || len(image) == 0 {
+		return image
+	}
+
+	if image == pins.Image && len(pins.ImageDigest) > 0 {
+		return pins.ImageDigest
+	}
+
+	if image == pins.ContextImage && len(pins.ContextImageDigest) > 0 {
+		return pins.ContextImageDigest
+	}
+
+	for _, tool := range pins.ToolImages {
+		if image == tool.Image && len(tool.Digest) > 0 {
+			return tool.Digest
+		}
+	}
+
+	return image
+}
+
+// toolImagesOf returns tool images of the app in order.
+func (r *CliAppReconciler) toolImagesOf(spec *appcorev1.CliAppSpec) []string {
+	images := make([]string, 0, len(spec.ToolImages))
+	for _, tool := range spec.ToolImages {
+		images = append(images, r.rewriteImage(tool.Image))
+	}
+
+	return images
+}
+
+// toolImageDigestsOf returns digests of pinned tool images.
+func toolImageDigestsOf(pins *appcorev1.CliAppPinnedImages) (digests []string) {
+	if pins == nil {
+		return nil
+	}
+
+	for _, tool := range pins.ToolImages {
+		if len(tool.Digest) > 0 {
+			digests = append(digests, tool.Digest)
+		}
+	}
+
+	return
+}
+
+func equalToolImages(pins *appcorev1.CliAppPinnedImages, images []string) bool {
+	if len(pins.ToolImages) != len(images) {
+		return false
+	}
+
+	for i := range images {
+		if pins.ToolImages[i].Image != images[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// computePodHash computes the hash of the app Pod. Digests of pinned images are involved so that the Pod is
+// rolled out once any of them changes.
+func computePodHash(spec *appcorev1.CliAppSpec, pins *appcorev1.CliAppPinnedImages) string {
+	toolDigests := toolImageDigestsOf(pins)
+	if pins == nil || len(pins.ImageDigest) == 0 && len(pins.ContextImageDigest) == 0 && len(toolDigests) == 0 {
+		return computeHash(spec)
+	}
+
+	hasher := fnv.New32a()
+	if len(toolDigests) == 0 {
+		deepHashObject(hasher, struct {
+			Spec               appcorev1.CliAppSpec
+			ImageDigest        string
+			ContextImageDigest string
+		}{*spec, pins.ImageDigest, pins.ContextImageDigest})
+	} else {
+		deepHashObject(hasher, struct {
+			Spec               appcorev1.CliAppSpec
+			ImageDigest        string
+			ContextImageDigest string
+			ToolImageDigests   []string
+		}{*spec, pins.ImageDigest, pins.ContextImageDigest, toolDigests})
+	}
+
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+func refreshIntervalOf(spec *appcorev1.CliAppSpec) time.Duration {
+	if spec.ImagePolicy == nil || spec.ImagePolicy.RefreshInterval == nil {
+		return 0
+	}
+
+	return spec.ImagePolicy.RefreshInterval.Duration
+}
+
+// resolveDigest resolves the image to its digest. It returns an empty string if the image can't be resolved.
+func (r *CliAppReconciler) resolveDigest(
+	ctx context.Context, log logr.Logger, app *appcorev1.CliApp, creds registryCredentials, image string,
+) string {
+	if len(image) == 0 {
+		return ""
+	}
+
+	config, err := r.ImageResolver.Resolve(ctx, log, image, creds)
+	if err != nil {
+		log.Error(err, "unable to resolve the image digest", "image", image)
+		r.Recorder.Eventf(app, corev1.EventTypeWarning, "DigestUnresolved", "unable to resolve image %s: %s",
+			image, err)
+		return ""
+	}
+
+	return config.Digest
+}
+
+// pinImages resolves tags of the app image, the context image and tool images to digests, which the app Pod is rendered with.
+// Images are resolved again if they change or the refresh interval passes. It returns the duration to the
+// next refresh.
+func (r *CliAppReconciler) pinImages(
+	ctx context.Context, log logr.Logger, app *appcorev1.CliApp,
+) (refreshAfter time.Duration) {
+	if r.ImageResolver == nil {
+		return
+	}
+
+	image := r.rewriteImage(app.Spec.Image)
+	if app.Spec.Fork != nil {
+		image = ""
+	}
+
+	_, _, ctxImage := r.appContextOf(&app.Spec)
+	if isNativeMode(&app.Spec) {
+		ctxImage = ""
+	}
+
+	toolImages := r.toolImagesOf(&app.Spec)
+	pins := app.Status.PinnedImages
+	interval := refreshIntervalOf(&app.Spec)
+	if pins != nil && pins.Image == image && pins.ContextImage == ctxImage && equalToolImages(pins, toolImages) {
+		if interval <= 0 {
+			return
+		}
+
+		if elapsed := time.Since(pins.ResolvedAt.Time); elapsed < interval {
+			return interval - elapsed
+		}
+	}
+
+	creds, err := r.imagePullCredentials(ctx, log, app, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: app.Namespace},
+		Spec:       corev1.PodSpec{ImagePullSecrets: app.Spec.ImagePullSecrets},
+	})
+	if err != nil {
+		log.Error(err, "unable to fetch pull secrets")
+	}
+
+	newPins := &appcorev1.CliAppPinnedImages{
+		Image:              image,
+		ImageDigest:        r.resolveDigest(ctx, log, app, creds, image),
+		ContextImage:       ctxImage,
+		ContextImageDigest: r.resolveDigest(ctx, log, app, creds, ctxImage),
+		ResolvedAt:         metav1.Now(),
+	}
+
+	// Keep digests if images are not changed but failed to resolve.
+	if pins != nil && pins.Image == image && len(newPins.ImageDigest) == 0 {
+		newPins.ImageDigest = pins.ImageDigest
+	}
+
+	if pins != nil && pins.ContextImage == ctxImage && len(newPins.ContextImageDigest) == 0 {
+		newPins.ContextImageDigest = pins.ContextImageDigest
+	}
+
+	toolsChanged := false
+	for i, image := range toolImages {
+		tool := appcorev1.CliAppPinnedToolImage{Image: image, Digest: r.resolveDigest(ctx, log, app, creds, image)}
+		if pins != nil && i < len(pins.ToolImages) && pins.ToolImages[i].Image == image {
+			if len(tool.Digest) == 0 {
+				tool.Digest = pins.ToolImages[i].Digest
+			}
+
+			toolsChanged = toolsChanged || tool.Digest != pins.ToolImages[i].Digest
+		}
+
+		newPins.ToolImages = append(newPins.ToolImages, tool)
+	}
+
+	if toolsChanged {
+		log.Info("tool image digests changed")
+		r.Recorder.Eventf(app, corev1.EventTypeNormal, "DigestChanged", "tool images are resolved to %q",
+			toolImageDigestsOf(newPins))
+	}
+
+	if pins != nil && (pins.ImageDigest != newPins.ImageDigest || pins.ContextImageDigest != newPins.ContextImageDigest) {
+		log.Info("image digests changed", "image", newPins.ImageDigest, "context", newPins.ContextImageDigest)
+		r.Recorder.Eventf(app, corev1.EventTypeNormal, "DigestChanged", "app images are resolved to %s and %s",
+			newPins.ImageDigest, newPins.ContextImageDigest)
+	}
+
+	app.Status.PinnedImages = newPins
+	if interval > 0 {
+		refreshAfter = interval
+	}
+
+	return
+}
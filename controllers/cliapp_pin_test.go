@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+)
+
+var _ = Describe("CliApp image pinning", func() {
+	pins := &appcorev1.CliAppPinnedImages{
+		Image:              "tools/kubectl:v1",
+		ImageDigest:        "docker.io/tools/kubectl@sha256:aaaa",
+		ContextImage:       "docker.io/warmmetal/app-context-bash-alpine:latest",
+		ContextImageDigest: "docker.io/warmmetal/app-context-bash-alpine@sha256:bbbb",
+	}
+
+	It("should render pinned images by digest", func() {
+		Expect(pinnedImageOf("tools/kubectl:v1", pins)).To(Equal(pins.ImageDigest))
+		Expect(pinnedImageOf(pins.ContextImage, pins)).To(Equal(pins.ContextImageDigest))
+		Expect(pinnedImageOf("tools/kubectl:v2", pins)).To(Equal("tools/kubectl:v2"))
+		Expect(pinnedImageOf("tools/kubectl:v1", nil)).To(Equal("tools/kubectl:v1"))
+	})
+
+	It("should roll out Pods once digests change", func() {
+		spec := &appcorev1.CliAppSpec{Image: "tools/kubectl:v1"}
+		Expect(computePodHash(spec, nil)).To(Equal(computeHash(spec)))
+		Expect(computePodHash(spec, &appcorev1.CliAppPinnedImages{Image: spec.Image})).To(Equal(computeHash(spec)))
+
+		moved := pins.DeepCopy()
+		moved.ImageDigest = "docker.io/tools/kubectl@sha256:cccc"
+		Expect(computePodHash(spec, pins)).NotTo(Equal(computeHash(spec)))
+		Expect(computePodHash(spec, moved)).NotTo(Equal(computePodHash(spec, pins)))
+
+		refreshed := pins.DeepCopy()
+		refreshed.ResolvedAt.Time = refreshed.ResolvedAt.Add(1)
+		Expect(computePodHash(spec, refreshed)).To(Equal(computePodHash(spec, pins)))
+	})
+
+	It("should pin tool images", func() {
+		tools := pins.DeepCopy()
+		tools.ToolImages = []appcorev1.CliAppPinnedToolImage{
+			{Image: "alpine/helm:3", Digest: "docker.io/alpine/helm@sha256:dddd"},
+		}
+		Expect(pinnedImageOf("alpine/helm:3", tools)).To(Equal("docker.io/alpine/helm@sha256:dddd"))
+		Expect(equalToolImages(tools, []string{"alpine/helm:3"})).To(BeTrue())
+		Expect(equalToolImages(tools, nil)).To(BeFalse())
+
+		spec := &appcorev1.CliAppSpec{Image: "tools/kubectl:v1"}
+		Expect(computePodHash(spec, tools)).NotTo(Equal(computePodHash(spec, pins)))
+		moved := tools.DeepCopy()
+		moved.ToolImages[0].Digest = "docker.io/alpine/helm@sha256:eeee"
+		Expect(computePodHash(spec, moved)).NotTo(Equal(computePodHash(spec, tools)))
+	})
+})
@@ -0,0 +1,348 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"hash/fnv"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+	"time"
+)
+
+const (
+	prePullLabel         = "cliapp.warm-metal.tech/pre-pull"
+	annoKeyPrePullImages = "cliapp.warm-metal.tech/pre-pull-images"
+	prePullContainer     = "pull"
+	prePullTimeout       = 15 * time.Minute
+)
+
+// prePullNodeSelector returns the nodeSelector in Spec.PodTemplate.
+func prePullNodeSelector(spec *appcorev1.CliAppSpec) labels.Selector {
+	if spec.PodTemplate == nil || len(spec.PodTemplate.Raw) == 0 {
+		return labels.Everything()
+	}
+
+	template := corev1.Pod{}
+	if err := json.Unmarshal(spec.PodTemplate.Raw, &template); err != nil {
+		return labels.Everything()
+	}
+
+	return labels.SelectorFromSet(template.Spec.NodeSelector)
+}
+
+func isNodeAvailable(node *corev1.Node) bool {
+	if node.Spec.Unschedulable || node.DeletionTimestamp != nil {
+		return false
+	}
+
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+func hashOf(node string, images []string) string {
+	hasher := fnv.New32a()
+	hasher.Write([]byte(node))
+	for _, image := range images {
+		hasher.Write([]byte{0})
+		hasher.Write([]byte(image))
+	}
+
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+func equalImages(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// prePullRetryWait returns how long to wait before pulling images again on the node where the last pull failed.
+// States failed before retries were introduced are retried at once.
+func prePullRetryWait(state *appcorev1.CliAppNodePrePull, backoff time.Duration) time.Duration {
+	if state.FailedAt == nil {
+		return 0
+	}
+
+	return time.Until(state.FailedAt.Add(retryBackoff(backoff, state.Retries)))
+}
+
+// minRequeue returns the shorter one of the two requeue durations, where zero means no requeue.
+func minRequeue(a, b time.Duration) time.Duration {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+
+	return a
+}
+
+// genPrePullPod generates a Pod on the node which runs the context image, or the native tools image in the Native
+// mode, and mounts the app image and tool images via the rootfs provider the same way as the app.
+// It exits once all images are pulled.
+// The Pod complies with the security profile of the app as well.
+func (r *CliAppReconciler) genPrePullPod(
+	app *appcorev1.CliApp, node string, images []string, provider appcorev1.CliAppRootfsProvider,
+) (*corev1.Pod, error) {
+	// The native tools image only promises busybox.
+	command := []string{"sh", "-c", "exit 0"}
+	if isNativeMode(&app.Spec) {
+		command = []string{toolsImageBusybox, "true"}
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			// Pods are named after the node and images so that a Pod won't be created twice.
+			Name:        fmt.Sprintf("%s-pull-%s", app.Name, hashOf(node, images)),
+			Namespace:   app.Namespace,
+			Labels:      map[string]string{prePullLabel: app.Name},
+			Annotations: map[string]string{annoKeyPrePullImages: strings.Join(images, ",")},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion:         app.APIVersion,
+					Kind:               app.Kind,
+					Name:               app.Name,
+					UID:                app.UID,
+					Controller:         &enabled,
+					BlockOwnerDeletion: &enabled,
+				},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:         node,
+			RestartPolicy:    corev1.RestartPolicyNever,
+			ImagePullSecrets: app.Spec.ImagePullSecrets,
+			Tolerations:      []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Containers: []corev1.Container{
+				{
+					Name:    prePullContainer,
+					Image:   images[0],
+					Command: command,
+				},
+			},
+		},
+	}
+
+	if err := installRootfs(pod, &pod.Spec.Containers[0], provider, images[1]); err != nil {
+		return nil, err
+	}
+
+	for i, image := range images[2:] {
+		name := app.Spec.ToolImages[i].Name
+		err := installImage(pod, &pod.Spec.Containers[0], provider, toolVolumePrefix+name, toolRootOf(name),
+			toolContainerPrefix+name, image)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	applySecurityProfile(pod, &pod.Spec.Containers[0], r.securityProfileOf(&app.Spec), "")
+	return pod, nil
+}
+
+// prePullStateOf checks whether the Pod finished pulling images.
+func prePullStateOf(pod *corev1.Pod) (phase appcorev1.CliAppPrePullPhase, message string) {
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		return appcorev1.CliAppPrePullPulled, ""
+	case corev1.PodFailed:
+		return appcorev1.CliAppPrePullFailed, pod.Status.Message
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && failedContainerReasons[status.State.Waiting.Reason] {
+			return appcorev1.CliAppPrePullFailed, fmt.Sprintf("%s: %s", status.State.Waiting.Reason,
+				status.State.Waiting.Message)
+		}
+	}
+
+	if time.Since(pod.CreationTimestamp.Time) > prePullTimeout {
+		return appcorev1.CliAppPrePullFailed, fmt.Sprintf("images are not pulled in %s", prePullTimeout)
+	}
+
+	return appcorev1.CliAppPrePullPulling, ""
+}
+
+func (r *CliAppReconciler) deletePrePullPods(ctx context.Context, log logr.Logger, app *appcorev1.CliApp) error {
+	err := r.DeleteAllOf(ctx, &corev1.Pod{}, client.InNamespace(app.Namespace),
+		client.MatchingLabels{prePullLabel: app.Name})
+	if err != nil {
+		log.Error(err, "unable to delete pre-pull pods")
+	}
+
+	return err
+}
+
+// prePullImages pulls the context image and the app image on nodes if Spec.PrePull is set.
+// Images are pulled again once they change. A positive duration is returned if pulling is in progress.
+func (r *CliAppReconciler) prePullImages(
+	ctx context.Context, log logr.Logger, app *appcorev1.CliApp,
+) (requeueAfter time.Duration, err error) {
+	if !app.Spec.PrePull || len(app.Spec.Image) == 0 || app.Spec.Fork != nil {
+		if app.Status.PrePull != nil {
+			if err = r.deletePrePullPods(ctx, log, app); err != nil {
+				return
+			}
+
+			app.Status.PrePull = nil
+			meta.RemoveStatusCondition(&app.Status.Conditions, appcorev1.CliAppConditionImagePrePulled)
+		}
+
+		return
+	}
+
+	provider, err := r.rootfsProviderOf(&app.Spec)
+	if err != nil {
+		log.Error(err, "unable to pre-pull images")
+		setCondition(app, appcorev1.CliAppConditionImagePrePulled, metav1.ConditionFalse, "PullFailed", err.Error())
+		err = nil
+		return
+	}
+
+	_, _, ctxImage := r.appContextOf(&app.Spec)
+	if isNativeMode(&app.Spec) {
+		// The tools image is pulled instead since it runs as an init container.
+		ctxImage = r.nativeToolsImage()
+	}
+
+	images := append([]string{ctxImage, r.rewriteImage(app.Spec.Image)}, r.toolImagesOf(&app.Spec)...)
+	if app.Status.PrePull == nil || !equalImages(app.Status.PrePull.Images, images) {
+		log.Info("pre-pull images", "images", images)
+		if err = r.deletePrePullPods(ctx, log, app); err != nil {
+			return
+		}
+
+		app.Status.PrePull = &appcorev1.CliAppPrePullStatus{Images: images}
+	}
+
+	nodeList := corev1.NodeList{}
+	if err = r.List(ctx, &nodeList, client.MatchingLabelsSelector{Selector: prePullNodeSelector(&app.Spec)}); err != nil {
+		log.Error(err, "unable to list nodes")
+		return
+	}
+
+	podList := corev1.PodList{}
+	err = r.List(ctx, &podList, client.InNamespace(app.Namespace), client.MatchingLabels{prePullLabel: app.Name})
+	if err != nil {
+		log.Error(err, "unable to list pre-pull pods")
+		return
+	}
+
+	pods := make(map[string]*corev1.Pod, len(podList.Items))
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		// Pods pulling outdated images may be still in the cache after deleted.
+		if pod.DeletionTimestamp == nil && pod.Annotations[annoKeyPrePullImages] == strings.Join(images, ",") {
+			pods[pod.Spec.NodeName] = pod
+		}
+	}
+
+	lastStates := make(map[string]*appcorev1.CliAppNodePrePull, len(app.Status.PrePull.Nodes))
+	for i := range app.Status.PrePull.Nodes {
+		lastStates[app.Status.PrePull.Nodes[i].Node] = &app.Status.PrePull.Nodes[i]
+	}
+
+	var states []appcorev1.CliAppNodePrePull
+	var pulled, failed int
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		if !isNodeAvailable(node) {
+			continue
+		}
+
+		state := appcorev1.CliAppNodePrePull{Node: node.Name, Phase: appcorev1.CliAppPrePullPulling}
+		if last := lastStates[node.Name]; last != nil {
+			state = *last
+		}
+
+		// Failed pulls are retried with backoff, in case of transient failures of registries.
+		if state.Phase == appcorev1.CliAppPrePullFailed {
+			if wait := prePullRetryWait(&state, r.RetryBackoff); wait > 0 {
+				requeueAfter = minRequeue(requeueAfter, wait)
+			} else {
+				log.Info("retry pre-pulling images", "node", node.Name, "retries", state.Retries)
+				state.Phase = appcorev1.CliAppPrePullPulling
+			}
+		}
+
+		if state.Phase == appcorev1.CliAppPrePullPulling {
+			if pod := pods[node.Name]; pod != nil {
+				state.Phase, state.Message = prePullStateOf(pod)
+				if state.Phase == appcorev1.CliAppPrePullFailed {
+					now := metav1.Now()
+					state.Retries++
+					state.FailedAt = &now
+					requeueAfter = minRequeue(requeueAfter, prePullRetryWait(&state, r.RetryBackoff))
+				}
+
+				if state.Phase != appcorev1.CliAppPrePullPulling {
+					log.Info("images pre-pulled", "node", node.Name, "phase", state.Phase, "message", state.Message)
+					if err = r.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+						log.Error(err, "unable to delete pre-pull pod", "pod", pod.Name)
+						return
+					}
+				}
+			} else {
+				var pod *corev1.Pod
+				if pod, err = r.genPrePullPod(app, node.Name, images, provider); err != nil {
+					return
+				}
+
+				if err = r.createPod(ctx, pod); !errors.IsAlreadyExists(err) && err != nil {
+					log.Error(err, "unable to create pre-pull pod", "node", node.Name)
+					return
+				}
+			}
+
+			err = nil
+		}
+
+		switch state.Phase {
+		case appcorev1.CliAppPrePullPulled:
+			pulled++
+		case appcorev1.CliAppPrePullFailed:
+			failed++
+		}
+
+		states = append(states, state)
+	}
+
+	app.Status.PrePull.Nodes = states
+	switch {
+	case failed > 0:
+		setCondition(app, appcorev1.CliAppConditionImagePrePulled, metav1.ConditionFalse, "PullFailed",
+			fmt.Sprintf("failed to pull images on %d of %d nodes", failed, len(states)))
+	case pulled < len(states):
+		setCondition(app, appcorev1.CliAppConditionImagePrePulled, metav1.ConditionFalse, "Pulling",
+			fmt.Sprintf("images are pulled on %d of %d nodes", pulled, len(states)))
+	default:
+		setCondition(app, appcorev1.CliAppConditionImagePrePulled, metav1.ConditionTrue, "Pulled",
+			fmt.Sprintf("images are pulled on all %d nodes", len(states)))
+	}
+
+	if pulled+failed < len(states) {
+		requeueAfter = minRequeue(requeueAfter, DefaultRequeueDuration)
+	}
+
+	return
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"time"
+)
+
+var _ = Describe("CliApp pre-pull", func() {
+	app := &appcorev1.CliApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "uid"},
+		Spec:       appcorev1.CliAppSpec{Image: "busybox", PrePull: true},
+	}
+
+	It("should generate a pull pod per node", func() {
+		images := []string{"ctx", "busybox"}
+		r := &CliAppReconciler{}
+		csi := appcorev1.CliAppRootfsProviderCSIImage
+		genPod := func(node string) *corev1.Pod {
+			pod, err := r.genPrePullPod(app, node, images, csi)
+			Expect(err).NotTo(HaveOccurred())
+			return pod
+		}
+
+		pod := genPod("node-1")
+		Expect(pod.Name).To(Equal(genPod("node-1").Name))
+		Expect(pod.Name).NotTo(Equal(genPod("node-2").Name))
+		Expect(pod.Labels).NotTo(HaveKey(appLabel))
+		Expect(pod.Spec.NodeName).To(Equal("node-1"))
+		Expect(pod.Spec.Containers[0].Image).To(Equal("ctx"))
+		Expect(pod.Spec.Volumes[0].CSI.VolumeAttributes).To(HaveKeyWithValue("image", "busybox"))
+
+		tools := app.DeepCopy()
+		tools.Spec.ToolImages = []appcorev1.CliAppToolImage{{Name: "helm", Image: "alpine/helm"}}
+		pod, err := r.genPrePullPod(tools, "node-1", append(images, "alpine/helm"), csi)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pod.Spec.Volumes).To(HaveLen(2))
+		Expect(pod.Spec.Volumes[1].Name).To(Equal(toolVolumePrefix + "helm"))
+		Expect(pod.Spec.Volumes[1].CSI.VolumeAttributes).To(HaveKeyWithValue("image", "alpine/helm"))
+
+		native := app.DeepCopy()
+		native.Spec.ExecutionMode = appcorev1.CliAppExecutionModeNative
+		pod, err = r.genPrePullPod(native, "node-1", images, csi)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pod.Spec.Containers[0].Command).To(Equal([]string{toolsImageBusybox, "true"}))
+	})
+
+	It("should retry failed pulls with backoff", func() {
+		state := &appcorev1.CliAppNodePrePull{Phase: appcorev1.CliAppPrePullFailed}
+		Expect(prePullRetryWait(state, time.Minute)).To(BeZero())
+
+		failedAt := metav1.Now()
+		state.FailedAt = &failedAt
+		state.Retries = 1
+		Expect(prePullRetryWait(state, time.Minute)).To(BeNumerically("~", time.Minute, time.Second))
+		state.Retries = 2
+		Expect(prePullRetryWait(state, time.Minute)).To(BeNumerically("~", 2*time.Minute, time.Second))
+
+		failedAt = metav1.NewTime(time.Now().Add(-3 * time.Minute))
+		Expect(prePullRetryWait(state, time.Minute)).To(BeNumerically("<=", 0))
+
+		Expect(minRequeue(0, time.Minute)).To(Equal(time.Minute))
+		Expect(minRequeue(time.Minute, 0)).To(Equal(time.Minute))
+		Expect(minRequeue(2*time.Minute, time.Minute)).To(Equal(time.Minute))
+	})
+
+	It("should select nodes by the pod template", func() {
+		spec := &appcorev1.CliAppSpec{
+			PodTemplate: &runtime.RawExtension{Raw: []byte(`{"spec":{"nodeSelector":{"disk":"ssd"}}}`)},
+		}
+		selector := prePullNodeSelector(spec)
+		Expect(selector.Matches(labels.Set{"disk": "ssd"})).To(BeTrue())
+		Expect(selector.Matches(labels.Set{"disk": "hdd"})).To(BeFalse())
+		Expect(prePullNodeSelector(&appcorev1.CliAppSpec{}).Empty()).To(BeTrue())
+	})
+
+	It("should report pulling states", func() {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.Now()}}
+		phase, _ := prePullStateOf(pod)
+		Expect(phase).To(Equal(appcorev1.CliAppPrePullPulling))
+
+		pod.Status.Phase = corev1.PodSucceeded
+		phase, _ = prePullStateOf(pod)
+		Expect(phase).To(Equal(appcorev1.CliAppPrePullPulled))
+
+		pod.Status.Phase = corev1.PodPending
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+		}}
+		phase, message := prePullStateOf(pod)
+		Expect(phase).To(Equal(appcorev1.CliAppPrePullFailed))
+		Expect(message).To(ContainSubstring("ImagePullBackOff"))
+
+		pod.Status.ContainerStatuses = nil
+		pod.CreationTimestamp = metav1.NewTime(time.Now().Add(-2 * prePullTimeout))
+		phase, _ = prePullStateOf(pod)
+		Expect(phase).To(Equal(appcorev1.CliAppPrePullFailed))
+	})
+})
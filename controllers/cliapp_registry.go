@@ -0,0 +1,311 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/containerd/remotes"
+	dockerremote "github.com/containerd/containerd/remotes/docker"
+	"github.com/go-logr/logr"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"golang.org/x/xerrors"
+	"io"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	imageConfigCacheSize = 512
+	imageConfigCacheTTL  = 24 * time.Hour
+	maxImageManifestSize = 4 << 20
+	registryTimeout      = 30 * time.Second
+)
+
+// ImageConfigResolver reads image configuration from registries. Configurations are cached by the image digest.
+type ImageConfigResolver struct {
+	// registries accessed via plain HTTP besides localhost
+	insecureRegistries map[string]bool
+	cache              *cache.LRUExpireCache
+}
+
+func NewImageConfigResolver(insecureRegistries []string) *ImageConfigResolver {
+	resolver := &ImageConfigResolver{
+		insecureRegistries: make(map[string]bool, len(insecureRegistries)),
+		cache:              cache.NewLRUExpireCache(imageConfigCacheSize),
+	}
+
+	for _, registry := range insecureRegistries {
+		resolver.insecureRegistries[registry] = true
+	}
+
+	return resolver
+}
+
+func (r *ImageConfigResolver) plainHTTP(host string) (bool, error) {
+	if r.insecureRegistries[host] {
+		return true, nil
+	}
+
+	return dockerremote.MatchLocalhost(host)
+}
+
+// registryCredentials are credentials of registries keyed by the registry host.
+type registryCredentials map[string]registryAuth
+
+type registryAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+type dockerConfigJSON struct {
+	Auths map[string]registryAuth `json:"auths"`
+}
+
+// registryHostOf converts keys of docker config to registry hosts,
+// such as "https://index.docker.io/v1/" to "index.docker.io".
+func registryHostOf(key string) string {
+	if strings.Contains(key, "://") {
+		if u, err := url.Parse(key); err == nil {
+			return u.Host
+		}
+	}
+
+	return strings.SplitN(key, "/", 2)[0]
+}
+
+// add adds credentials in a pull secret. Existing credentials take precedence.
+func (c registryCredentials) add(secret *corev1.Secret) error {
+	var auths map[string]registryAuth
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		config := dockerConfigJSON{}
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+			return xerrors.Errorf("unable to decode pull secret %s: %s", secret.Name, err)
+		}
+
+		auths = config.Auths
+	case corev1.SecretTypeDockercfg:
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigKey], &auths); err != nil {
+			return xerrors.Errorf("unable to decode pull secret %s: %s", secret.Name, err)
+		}
+	default:
+		return xerrors.Errorf("secret %s is not a pull secret", secret.Name)
+	}
+
+	for key, auth := range auths {
+		host := registryHostOf(key)
+		if _, found := c[host]; !found {
+			c[host] = auth
+		}
+	}
+
+	return nil
+}
+
+// lookup returns credentials of the registry host. It is called by the registry authorizer.
+func (c registryCredentials) lookup(host string) (username, password string, err error) {
+	auth, found := c[host]
+	if !found && (host == "registry-1.docker.io" || host == "docker.io") {
+		auth, found = c["index.docker.io"]
+	}
+
+	if !found {
+		return
+	}
+
+	if len(auth.Username) > 0 || len(auth.Password) > 0 {
+		return auth.Username, auth.Password, nil
+	}
+
+	if len(auth.Auth) > 0 {
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return "", "", xerrors.Errorf("invalid auth of registry %s: %s", host, err)
+		}
+
+		pair := strings.SplitN(string(decoded), ":", 2)
+		if len(pair) != 2 {
+			return "", "", xerrors.Errorf("invalid auth of registry %s", host)
+		}
+
+		return pair[0], pair[1], nil
+	}
+
+	return
+}
+
+func fetchBlob(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor) ([]byte, error) {
+	if desc.Size > maxImageManifestSize {
+		return nil, xerrors.Errorf("%s is too large: %d bytes", desc.Digest, desc.Size)
+	}
+
+	reader, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+	blob, err := ioutil.ReadAll(io.LimitReader(reader, maxImageManifestSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = desc.Digest.Validate(); err == nil && desc.Digest.Algorithm().FromBytes(blob) != desc.Digest {
+		return nil, xerrors.Errorf("digest of %s mismatched", desc.Digest)
+	}
+
+	return blob, nil
+}
+
+// fetchManifest fetches the image manifest. The manifest of the current platform is chosen from an index.
+func fetchManifest(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor) (*ocispec.Manifest, error) {
+	blob, err := fetchBlob(ctx, fetcher, desc)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to fetch manifest %s: %s", desc.Digest, err)
+	}
+
+	switch desc.MediaType {
+	case images.MediaTypeDockerSchema2Manifest, ocispec.MediaTypeImageManifest:
+		manifest := &ocispec.Manifest{}
+		if err = json.Unmarshal(blob, manifest); err != nil {
+			return nil, xerrors.Errorf("unable to decode manifest %s: %s", desc.Digest, err)
+		}
+
+		return manifest, nil
+	case images.MediaTypeDockerSchema2ManifestList, ocispec.MediaTypeImageIndex:
+		index := ocispec.Index{}
+		if err = json.Unmarshal(blob, &index); err != nil {
+			return nil, xerrors.Errorf("unable to decode index %s: %s", desc.Digest, err)
+		}
+
+		matcher := platforms.Default()
+		for _, m := range index.Manifests {
+			if m.Platform == nil || matcher.Match(*m.Platform) {
+				return fetchManifest(ctx, fetcher, m)
+			}
+		}
+
+		return nil, xerrors.Errorf("no manifest found in %s for platform %s", desc.Digest,
+			platforms.DefaultString())
+	default:
+		return nil, xerrors.Errorf("unsupported manifest type %s", desc.MediaType)
+	}
+}
+
+// Resolve fetches the configuration of the image from its registry.
+func (r *ImageConfigResolver) Resolve(
+	ctx context.Context, log logr.Logger, image string, creds registryCredentials,
+) (config imageConfiguration, err error) {
+	named, err := docker.ParseDockerRef(image)
+	if err != nil {
+		return config, xerrors.Errorf("invalid image %s: %s", image, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, registryTimeout)
+	defer cancel()
+
+	resolver := dockerremote.NewResolver(dockerremote.ResolverOptions{
+		Hosts: dockerremote.ConfigureDefaultRegistries(
+			dockerremote.WithAuthorizer(dockerremote.NewDockerAuthorizer(dockerremote.WithAuthCreds(creds.lookup))),
+			dockerremote.WithPlainHTTP(r.plainHTTP),
+		),
+	})
+
+	name, desc, err := resolver.Resolve(ctx, named.String())
+	if err != nil {
+		return config, xerrors.Errorf("unable to resolve image %s: %s", image, err)
+	}
+
+	if cached, found := r.cache.Get(desc.Digest); found {
+		config = cached.(imageConfiguration)
+		config.Digest = docker.TrimNamed(named).String() + "@" + desc.Digest.String()
+		return
+	}
+
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return config, xerrors.Errorf("unable to fetch image %s: %s", image, err)
+	}
+
+	manifest, err := fetchManifest(ctx, fetcher, desc)
+	if err != nil {
+		return
+	}
+
+	blob, err := fetchBlob(ctx, fetcher, manifest.Config)
+	if err != nil {
+		return config, xerrors.Errorf("unable to fetch config of image %s: %s", image, err)
+	}
+
+	imageSpec := ocispec.Image{}
+	if err = json.Unmarshal(blob, &imageSpec); err != nil {
+		return config, xerrors.Errorf("unable to decode config of image %s: %s", image, err)
+	}
+
+	config.Env = imageSpec.Config.Env
+	config.User = imageSpec.Config.User
+	config.Entrypoint = imageSpec.Config.Entrypoint
+	config.Cmd = imageSpec.Config.Cmd
+	config.WorkingDir = imageSpec.Config.WorkingDir
+	config.Path = pathOf(imageSpec.Config.Env)
+	r.cache.Add(desc.Digest, config, imageConfigCacheTTL)
+
+	log.V(1).Info("image config fetched from registry", "image", image, "digest", desc.Digest)
+	config.Digest = docker.TrimNamed(named).String() + "@" + desc.Digest.String()
+	return
+}
+
+// imagePullCredentials collects credentials in pull secrets of the Pod and its service account.
+func (r *CliAppReconciler) imagePullCredentials(
+	ctx context.Context, log logr.Logger, app *appcorev1.CliApp, pod *corev1.Pod,
+) (registryCredentials, error) {
+	creds := make(registryCredentials)
+	clientset, err := r.kubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// The pod template could set the service account or pull secrets of the final Pod.
+	if patched, err := mergePodTemplate(pod, app); err != nil {
+		log.Error(err, "unable to apply the pod template to fetch pull secrets")
+	} else {
+		pod = patched
+	}
+
+	secrets := append([]corev1.LocalObjectReference{}, pod.Spec.ImagePullSecrets...)
+	serviceAccount := pod.Spec.ServiceAccountName
+	if len(serviceAccount) == 0 {
+		serviceAccount = "default"
+	}
+
+	sa, err := clientset.CoreV1().ServiceAccounts(pod.Namespace).Get(ctx, serviceAccount, metav1.GetOptions{})
+	if err != nil {
+		log.Error(err, "unable to fetch service account", "serviceaccount", serviceAccount)
+	} else {
+		secrets = append(secrets, sa.ImagePullSecrets...)
+	}
+
+	for _, ref := range secrets {
+		secret, err := clientset.CoreV1().Secrets(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			log.Error(err, "unable to fetch pull secret", "secret", ref.Name)
+			continue
+		}
+
+		if err = creds.add(secret); err != nil {
+			log.Error(err, "invalid pull secret", "secret", ref.Name)
+		}
+	}
+
+	return creds, nil
+}
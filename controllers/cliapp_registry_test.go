@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	corev1 "k8s.io/api/core/v1"
+	"net/http"
+	"net/http/httptest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// fakeRegistry serves an image "tools/kubectl:latest" in the form of an index, behind basic auth.
+type fakeRegistry struct {
+	blobs         map[digest.Digest][]byte
+	mediaTypes    map[digest.Digest]string
+	index         digest.Digest
+	config        digest.Digest
+	configFetches int32
+}
+
+func (f *fakeRegistry) add(mediaType string, v interface{}) ocispec.Descriptor {
+	blob, err := json.Marshal(v)
+	Expect(err).NotTo(HaveOccurred())
+	d := digest.FromBytes(blob)
+	f.blobs[d] = blob
+	f.mediaTypes[d] = mediaType
+	return ocispec.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(blob))}
+}
+
+func newFakeRegistry() *fakeRegistry {
+	f := &fakeRegistry{blobs: make(map[digest.Digest][]byte), mediaTypes: make(map[digest.Digest]string)}
+	image := ocispec.Image{}
+	image.Config.Env = []string{"PATH=/opt/bin:/usr/bin", "KUBECONFIG=/etc/kube/config"}
+	image.Config.User = "1000"
+	image.Config.Entrypoint = []string{"kubectl"}
+	image.Config.WorkingDir = "/work"
+	config := f.add(ocispec.MediaTypeImageConfig, image)
+	f.config = config.Digest
+
+	manifest := f.add(ocispec.MediaTypeImageManifest, ocispec.Manifest{Config: config})
+	manifest.Platform = &ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	another := manifest
+	another.Platform = &ocispec.Platform{OS: "linux", Architecture: "arm64"}
+	f.index = f.add(ocispec.MediaTypeImageIndex, ocispec.Index{
+		Manifests: []ocispec.Descriptor{another, manifest},
+	}).Digest
+	return f
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	user, password, ok := req.BasicAuth()
+	if !ok || user != "user" || password != "secret" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="fake"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var d digest.Digest
+	switch {
+	case req.URL.Path == "/v2/":
+		return
+	case req.URL.Path == "/v2/tools/kubectl/manifests/latest":
+		d = f.index
+	case strings.HasPrefix(req.URL.Path, "/v2/tools/kubectl/manifests/"):
+		d = digest.Digest(strings.TrimPrefix(req.URL.Path, "/v2/tools/kubectl/manifests/"))
+	case strings.HasPrefix(req.URL.Path, "/v2/tools/kubectl/blobs/"):
+		d = digest.Digest(strings.TrimPrefix(req.URL.Path, "/v2/tools/kubectl/blobs/"))
+	}
+
+	blob, found := f.blobs[d]
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if d == f.config && req.Method == http.MethodGet {
+		atomic.AddInt32(&f.configFetches, 1)
+	}
+
+	w.Header().Set("Content-Type", f.mediaTypes[d])
+	w.Header().Set("Docker-Content-Digest", d.String())
+	w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+	if req.Method == http.MethodGet {
+		w.Write(blob)
+	}
+}
+
+var _ = Describe("Image config resolver", func() {
+	It("should fetch image config from the registry with pull secrets", func() {
+		registry := newFakeRegistry()
+		server := httptest.NewServer(registry)
+		defer server.Close()
+
+		host := strings.TrimPrefix(server.URL, "http://")
+		creds := make(registryCredentials)
+		Expect(creds.add(&corev1.Secret{
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: []byte(fmt.Sprintf(`{"auths":{"http://%s/v2/":{"auth":"%s"}}}`,
+					host, base64.StdEncoding.EncodeToString([]byte("user:secret")))),
+			},
+		})).To(Succeed())
+
+		resolver := NewImageConfigResolver(nil)
+		log := ctrl.Log.WithName("test")
+		image := host + "/tools/kubectl"
+		config, err := resolver.Resolve(context.TODO(), log, image, creds)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Path).To(Equal("/opt/bin:/usr/bin"))
+		Expect(config.WorkingDir).To(Equal("/work"))
+		Expect(config.User).To(Equal("1000"))
+		Expect(config.Entrypoint).To(Equal([]string{"kubectl"}))
+		Expect(config.Env).To(ContainElement("KUBECONFIG=/etc/kube/config"))
+		Expect(config.Digest).To(Equal(image + "@" + registry.index.String()))
+
+		config, err = resolver.Resolve(context.TODO(), log, image+":latest", creds)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.WorkingDir).To(Equal("/work"))
+		Expect(atomic.LoadInt32(&registry.configFetches)).To(Equal(int32(1)))
+
+		_, err = resolver.Resolve(context.TODO(), log, image, make(registryCredentials))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should decode legacy pull secrets", func() {
+		creds := make(registryCredentials)
+		Expect(creds.add(&corev1.Secret{
+			Type: corev1.SecretTypeDockercfg,
+			Data: map[string][]byte{
+				corev1.DockerConfigKey: []byte(`{"https://index.docker.io/v1/":{"username":"u","password":"p"}}`),
+			},
+		})).To(Succeed())
+
+		user, password, err := creds.lookup("registry-1.docker.io")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user).To(Equal("u"))
+		Expect(password).To(Equal("p"))
+	})
+})
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// mergeResourceList sets every resource of override to base.
+func mergeResourceList(base, override corev1.ResourceList) corev1.ResourceList {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+
+	merged := make(corev1.ResourceList, len(base)+len(override))
+	for name, quantity := range base {
+		merged[name] = quantity.DeepCopy()
+	}
+
+	for name, quantity := range override {
+		merged[name] = quantity.DeepCopy()
+	}
+
+	return merged
+}
+
+// mergeResources overlays resources of each layer in order. Resources of latter layers take precedence.
+func mergeResources(layers ...corev1.ResourceRequirements) (merged corev1.ResourceRequirements) {
+	for _, layer := range layers {
+		merged.Requests = mergeResourceList(merged.Requests, layer.Requests)
+		merged.Limits = mergeResourceList(merged.Limits, layer.Limits)
+	}
+
+	return
+}
+
+func validateResources(resources *corev1.ResourceRequirements, max corev1.ResourceList) error {
+	for name, request := range resources.Requests {
+		if limit, found := resources.Limits[name]; found && request.Cmp(limit) > 0 {
+			return xerrors.Errorf("request of %s %s is greater than its limit %s",
+				name, request.String(), limit.String())
+		}
+	}
+
+	for name, maxQuantity := range max {
+		if request, found := resources.Requests[name]; found && request.Cmp(maxQuantity) > 0 {
+			return xerrors.Errorf("request of %s %s exceeds the maximum %s", name, request.String(), maxQuantity.String())
+		}
+
+		if limit, found := resources.Limits[name]; found && limit.Cmp(maxQuantity) > 0 {
+			return xerrors.Errorf("limit of %s %s exceeds the maximum %s", name, limit.String(), maxQuantity.String())
+		}
+	}
+
+	return nil
+}
@@ -11,19 +11,15 @@ import (
 )
 
 func (r *CliAppReconciler) makeAppRest(ctx context.Context, log logr.Logger, app *appcorev1.CliApp) (result ctrl.Result, err error) {
-	if app.Spec.TargetPhase != appcorev1.CliAppPhaseRest {
-		panic(app.Name)
-	}
-
-	log.V(1).Info("app status transits", "from", app.Status.Phase, "to", app.Spec.TargetPhase)
+	log.V(1).Info("app status transits", "from", app.Status.Phase, "to", appcorev1.CliAppPhaseRest)
 
 	switch app.Status.Phase {
 	case appcorev1.CliAppPhaseLive:
 		targetPhase := appcorev1.CliAppPhaseShuttingDown
 		result.Requeue = true
-		if !app.Spec.UninstallUnlessLive {
+		if idleTimeout := r.idleTimeout(&app.Spec); !app.Spec.UninstallUnlessLive && idleTimeout > 0 {
 			targetPhase = appcorev1.CliAppPhaseWaitingForSessions
-			result.RequeueAfter = r.DurationIdleLiveLasts
+			result.RequeueAfter = idleTimeout
 		} else {
 			app.Status.PodName = ""
 		}
@@ -36,13 +32,13 @@ func (r *CliAppReconciler) makeAppRest(ctx context.Context, log logr.Logger, app
 	case appcorev1.CliAppPhaseWaitingForSessions:
 		now := metav1.Now()
 		elapse := now.Sub(app.Status.LastPhaseTransition.Time)
-		if elapse < r.DurationIdleLiveLasts {
-			result.RequeueAfter = r.DurationIdleLiveLasts - elapse
+		if idleTimeout := r.idleTimeout(&app.Spec); elapse < idleTimeout {
+			result.RequeueAfter = idleTimeout - elapse
 			return
 		}
 
 		fallthrough
-	case "", appcorev1.CliAppPhaseRecovering:
+	case "", appcorev1.CliAppPhaseRecovering, appcorev1.CliAppPhaseFailed:
 		err = r.transitPhaseTo(ctx, log, app, appcorev1.CliAppPhaseShuttingDown)
 		result.Requeue = true
 		return
@@ -55,6 +51,10 @@ func (r *CliAppReconciler) makeAppRest(ctx context.Context, log logr.Logger, app
 		}
 
 		if len(podList.Items) == 0 {
+			if err = r.releaseUserHomes(ctx, log, app); err != nil {
+				return
+			}
+
 			if app.Spec.UninstallUnlessLive {
 				err = r.Delete(ctx, app)
 			} else {
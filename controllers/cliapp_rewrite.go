@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"github.com/containerd/containerd/reference/docker"
+	"strings"
+)
+
+// rewriteImage rewrites the image reference with the longest matched prefix in ImagePrefixRewrites,
+// or replaces its registry with the mirror in RegistryMirrors. Prefixes and registries are matched against
+// the fully qualified reference, such as "docker.io/library/busybox:latest".
+// The image is returned as is if no rule matches.
+func (r *CliAppReconciler) rewriteImage(image string) string {
+	if len(image) == 0 || len(r.ImagePrefixRewrites) == 0 && len(r.RegistryMirrors) == 0 {
+		return image
+	}
+
+	named, err := docker.ParseDockerRef(image)
+	if err != nil {
+		r.Log.Error(err, "invalid image", "image", image)
+		return image
+	}
+
+	ref := named.String()
+	matched := ""
+	for prefix := range r.ImagePrefixRewrites {
+		if strings.HasPrefix(ref, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+		}
+	}
+
+	if len(matched) > 0 {
+		return r.ImagePrefixRewrites[matched] + ref[len(matched):]
+	}
+
+	domain := docker.Domain(named)
+	if mirror, found := r.RegistryMirrors[domain]; found && len(mirror) > 0 {
+		return strings.TrimSuffix(mirror, "/") + ref[len(domain):]
+	}
+
+	return image
+}
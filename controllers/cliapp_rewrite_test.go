@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("CliApp image rewriting", func() {
+	r := &CliAppReconciler{
+		Log: ctrl.Log.WithName("test"),
+		RegistryMirrors: map[string]string{
+			"docker.io": "mirror.local:5000/",
+			"quay.io":   "quay.mirror.local",
+		},
+		ImagePrefixRewrites: map[string]string{
+			"docker.io/warmmetal/":                     "registry.local/warmmetal/",
+			"docker.io/warmmetal/app-context-bash-alp": "registry.local/contexts/app-context-bash-alp",
+		},
+	}
+
+	It("should rewrite images with the longest prefix", func() {
+		Expect(r.rewriteImage("warmmetal/kubectl:v1")).To(Equal("registry.local/warmmetal/kubectl:v1"))
+		Expect(r.rewriteImage("docker.io/warmmetal/app-context-bash-alpine:latest")).
+			To(Equal("registry.local/contexts/app-context-bash-alpine:latest"))
+	})
+
+	It("should replace registries with mirrors", func() {
+		Expect(r.rewriteImage("busybox")).To(Equal("mirror.local:5000/library/busybox:latest"))
+		Expect(r.rewriteImage("quay.io/tools/jq@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")).
+			To(Equal("quay.mirror.local/tools/jq@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"))
+	})
+
+	It("should keep images matching no rules", func() {
+		Expect(r.rewriteImage("gcr.io/tools/gcloud:v1")).To(Equal("gcr.io/tools/gcloud:v1"))
+		Expect(r.rewriteImage("")).To(Equal(""))
+		Expect((&CliAppReconciler{}).rewriteImage("busybox")).To(Equal("busybox"))
+	})
+})
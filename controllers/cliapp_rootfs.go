@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/kubernetes"
+	"strings"
+)
+
+const (
+	rootfsContainer    = "rootfs"
+	annoKeyImageVolume = "cliapp.warm-metal.tech/image-volume"
+)
+
+// The earliest Kubernetes version supports image volumes.
+var minImageVolumeVersion = version.MustParseGeneric("1.31")
+
+// Providers in the order of preference if the controller doesn't specify one.
+var rootfsProviders = []appcorev1.CliAppRootfsProvider{
+	appcorev1.CliAppRootfsProviderCSIImage,
+	appcorev1.CliAppRootfsProviderImageVolume,
+	appcorev1.CliAppRootfsProviderInitContainer,
+}
+
+func ValidateRootfsProvider(p appcorev1.CliAppRootfsProvider) error {
+	for _, provider := range rootfsProviders {
+		if p == provider {
+			return nil
+		}
+	}
+
+	return xerrors.Errorf("rootfs provider must be one of %q", rootfsProviders)
+}
+
+// DetectRootfsProviders checks which rootfs providers the cluster supports.
+// The CSI driver must be registered. Image volumes require Kubernetes 1.31 or later, while the feature gate
+// ImageVolume can't be detected. InitContainer is always available.
+func DetectRootfsProviders(
+	ctx context.Context, clientset kubernetes.Interface,
+) (map[appcorev1.CliAppRootfsProvider]bool, error) {
+	providers := map[appcorev1.CliAppRootfsProvider]bool{appcorev1.CliAppRootfsProviderInitContainer: true}
+	_, err := clientset.StorageV1().CSIDrivers().Get(ctx, csiImageDriverName, metav1.GetOptions{})
+	if err == nil {
+		providers[appcorev1.CliAppRootfsProviderCSIImage] = true
+	} else if !errors.IsNotFound(err) {
+		return nil, xerrors.Errorf("unable to fetch CSI driver %s: %s", csiImageDriverName, err)
+	}
+
+	info, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return nil, xerrors.Errorf("unable to fetch the server version: %s", err)
+	}
+
+	serverVersion, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid server version %s: %s", info.GitVersion, err)
+	}
+
+	if serverVersion.AtLeast(minImageVolumeVersion) {
+		providers[appcorev1.CliAppRootfsProviderImageVolume] = true
+	}
+
+	return providers, nil
+}
+
+// DefaultRootfsProvider returns the configured provider if it is available, or the first available one.
+func DefaultRootfsProvider(
+	available map[appcorev1.CliAppRootfsProvider]bool, configured appcorev1.CliAppRootfsProvider,
+) (appcorev1.CliAppRootfsProvider, error) {
+	if len(configured) > 0 {
+		if err := ValidateRootfsProvider(configured); err != nil {
+			return "", err
+		}
+
+		if !available[configured] {
+			return "", xerrors.Errorf("rootfs provider %s is not available in the cluster", configured)
+		}
+
+		return configured, nil
+	}
+
+	for _, provider := range rootfsProviders {
+		if available[provider] {
+			return provider, nil
+		}
+	}
+
+	return "", xerrors.Errorf("no rootfs provider is available")
+}
+
+// rootfsProviderOf returns the rootfs provider of the app.
+func (r *CliAppReconciler) rootfsProviderOf(spec *appcorev1.CliAppSpec) (appcorev1.CliAppRootfsProvider, error) {
+	provider := r.DefaultRootfsProvider
+	if len(spec.RootfsProvider) > 0 {
+		provider = spec.RootfsProvider
+	}
+
+	if len(provider) == 0 {
+		provider = appcorev1.CliAppRootfsProviderCSIImage
+	}
+
+	if r.RootfsProviders != nil && !r.RootfsProviders[provider] {
+		return "", xerrors.Errorf("rootfs provider %s is not available in the cluster", provider)
+	}
+
+	return provider, nil
+}
+
+// checkRootfsMounts checks whether volumes of the feature could be mounted in the app rootfs. The ImageVolume
+// provider mounts the rootfs read-only, so mount points can't be created in it.
+func (r *CliAppReconciler) checkRootfsMounts(spec *appcorev1.CliAppSpec, feature string) error {
+	if isNativeMode(spec) {
+		return nil
+	}
+
+	provider, err := r.rootfsProviderOf(spec)
+	if err != nil {
+		return err
+	}
+
+	if provider == appcorev1.CliAppRootfsProviderImageVolume {
+		return xerrors.Errorf("%s can't be mounted in the read-only rootfs of the %s provider", feature, provider)
+	}
+
+	return nil
+}
+
+// copyRootfsScript copies all files of the image to the mount point except those of the kernel and
+// the mount point itself.
+func copyRootfsScript(mountPath string) string {
+	return fmt.Sprintf(
+		`cd / && for f in * .[!.]*; do case "$f" in proc|sys|dev|%s|'.[!.]*') ;; *) cp -a "$f" %s/ ;; esac; done`,
+		strings.SplitN(strings.TrimPrefix(mountPath, "/"), "/", 2)[0], mountPath,
+	)
+}
+
+// installRootfs mounts the image at appRoot of the container via the provider.
+func installRootfs(
+	pod *corev1.Pod, container *corev1.Container, provider appcorev1.CliAppRootfsProvider, image string,
+) error {
+	return installImage(pod, container, provider, appImageVolume, appRoot, rootfsContainer, image)
+}
+
+// installImage mounts the image at the mount path of the container via the provider, in the volume of the name.
+// The init container is used by the InitContainer provider.
+func installImage(
+	pod *corev1.Pod, container *corev1.Container, provider appcorev1.CliAppRootfsProvider,
+	volume, mountPath, initContainer, image string,
+) error {
+	mount := corev1.VolumeMount{
+		Name:      volume,
+		MountPath: mountPath,
+	}
+
+	switch provider {
+	case appcorev1.CliAppRootfsProviderCSIImage:
+		imageVolume := appImageVolumeOf(image)
+		imageVolume.Name = volume
+		pod.Spec.Volumes = append(pod.Spec.Volumes, imageVolume)
+	case appcorev1.CliAppRootfsProviderImageVolume:
+		// The source of image volumes is not in the API this controller is built with,
+		// so it is set by createPod according to the annotation.
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{Name: volume})
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+
+		images := map[string]string{}
+		if value, found := pod.Annotations[annoKeyImageVolume]; found {
+			if err := json.Unmarshal([]byte(value), &images); err != nil {
+				return xerrors.Errorf("invalid annotation %s: %s", annoKeyImageVolume, err)
+			}
+		}
+
+		images[volume] = image
+		value, _ := json.Marshal(images)
+		pod.Annotations[annoKeyImageVolume] = string(value)
+		mount.ReadOnly = true
+	case appcorev1.CliAppRootfsProviderInitContainer:
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name:         volume,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{
+			Name:         initContainer,
+			Image:        image,
+			Command:      []string{"sh", "-c", copyRootfsScript(mountPath)},
+			VolumeMounts: []corev1.VolumeMount{mount},
+		})
+	default:
+		return xerrors.Errorf("unknown rootfs provider %s", provider)
+	}
+
+	container.VolumeMounts = append(container.VolumeMounts, mount)
+	return nil
+}
+
+// createPod creates the Pod. Image volumes are set if the Pod is annotated.
+func (r *CliAppReconciler) createPod(ctx context.Context, pod *corev1.Pod) error {
+	value, found := pod.Annotations[annoKeyImageVolume]
+	if !found {
+		return r.Create(ctx, pod)
+	}
+
+	images := map[string]string{}
+	if err := json.Unmarshal([]byte(value), &images); err != nil {
+		return xerrors.Errorf("invalid annotation %s of Pod %s: %s", annoKeyImageVolume, pod.Name, err)
+	}
+
+	manifest, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+	if err != nil {
+		return xerrors.Errorf("unable to convert Pod %s: %s", pod.Name, err)
+	}
+
+	volumes, _, _ := unstructured.NestedSlice(manifest, "spec", "volumes")
+	for i := range volumes {
+		volume := volumes[i].(map[string]interface{})
+		if image, found := images[volume["name"].(string)]; found {
+			volume["image"] = map[string]interface{}{
+				"reference":  image,
+				"pullPolicy": string(corev1.PullIfNotPresent),
+			}
+		}
+	}
+
+	if err = unstructured.SetNestedSlice(manifest, volumes, "spec", "volumes"); err != nil {
+		return xerrors.Errorf("unable to set volumes of Pod %s: %s", pod.Name, err)
+	}
+
+	obj := &unstructured.Unstructured{Object: manifest}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Pod")
+	if err = r.Create(ctx, obj); err != nil {
+		return err
+	}
+
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, pod)
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("CliApp rootfs providers", func() {
+	It("should mount the image via providers", func() {
+		install := func(provider appcorev1.CliAppRootfsProvider) *corev1.Pod {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: appContainer}}}}
+			Expect(installRootfs(pod, &pod.Spec.Containers[0], provider, "busybox")).To(Succeed())
+			return pod
+		}
+
+		pod := install(appcorev1.CliAppRootfsProviderCSIImage)
+		Expect(pod.Spec.Volumes[0].CSI.VolumeAttributes).To(HaveKeyWithValue("image", "busybox"))
+		Expect(pod.Spec.Containers[0].VolumeMounts[0].MountPath).To(Equal(appRoot))
+
+		pod = install(appcorev1.CliAppRootfsProviderImageVolume)
+		Expect(pod.Annotations).To(HaveKeyWithValue(annoKeyImageVolume, `{"app":"busybox"}`))
+		Expect(pod.Spec.Volumes[0].Name).To(Equal(appImageVolume))
+		Expect(pod.Spec.Containers[0].VolumeMounts[0].ReadOnly).To(BeTrue())
+
+		pod = install(appcorev1.CliAppRootfsProviderInitContainer)
+		Expect(pod.Spec.Volumes[0].EmptyDir).NotTo(BeNil())
+		Expect(pod.Spec.InitContainers[0].Image).To(Equal("busybox"))
+		Expect(pod.Spec.InitContainers[0].VolumeMounts[0].MountPath).To(Equal(appRoot))
+		Expect(pod.Spec.Containers[0].VolumeMounts[0].Name).To(Equal(appImageVolume))
+
+		pod = &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: appContainer}}}}
+		Expect(installRootfs(pod, &pod.Spec.Containers[0], "Unknown", "busybox")).NotTo(Succeed())
+	})
+
+	It("should choose available providers", func() {
+		available := map[appcorev1.CliAppRootfsProvider]bool{appcorev1.CliAppRootfsProviderInitContainer: true}
+		provider, err := DefaultRootfsProvider(available, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(provider).To(Equal(appcorev1.CliAppRootfsProviderInitContainer))
+
+		_, err = DefaultRootfsProvider(available, appcorev1.CliAppRootfsProviderCSIImage)
+		Expect(err).To(HaveOccurred())
+
+		r := &CliAppReconciler{DefaultRootfsProvider: provider, RootfsProviders: available}
+		provider, err = r.rootfsProviderOf(&appcorev1.CliAppSpec{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(provider).To(Equal(appcorev1.CliAppRootfsProviderInitContainer))
+
+		_, err = r.rootfsProviderOf(&appcorev1.CliAppSpec{RootfsProvider: appcorev1.CliAppRootfsProviderImageVolume})
+		Expect(err).To(HaveOccurred())
+	})
+})
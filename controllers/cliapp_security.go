@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strconv"
+	"strings"
+)
+
+const (
+	// reason of the failure that the app Pod violates the security profile.
+	securityProfileViolatedReason = "SecurityProfileViolated"
+
+	// the user apps run as under the Restricted profile if their images run as root.
+	nonRootUser = int64(65534)
+)
+
+// Capabilities the baseline profile allows to add.
+var baselineCapabilities = map[corev1.Capability]bool{
+	"AUDIT_WRITE":      true,
+	"CHOWN":            true,
+	"DAC_OVERRIDE":     true,
+	"FOWNER":           true,
+	"FSETID":           true,
+	"KILL":             true,
+	"MKNOD":            true,
+	"NET_BIND_SERVICE": true,
+	"SETFCAP":          true,
+	"SETGID":           true,
+	"SETPCAP":          true,
+	"SETUID":           true,
+	"SYS_CHROOT":       true,
+}
+
+// securityProfileError is returned if the app Pod violates its security profile.
+type securityProfileError struct {
+	profile appcorev1.CliAppSecurityProfile
+	reason  string
+}
+
+func (e *securityProfileError) Error() string {
+	return fmt.Sprintf("%s, which the %s security profile disallows", e.reason, e.profile)
+}
+
+func ValidateSecurityProfile(p appcorev1.CliAppSecurityProfile) error {
+	switch p {
+	case appcorev1.CliAppSecurityProfilePrivileged, appcorev1.CliAppSecurityProfileBaseline,
+		appcorev1.CliAppSecurityProfileRestricted:
+		return nil
+	default:
+		return xerrors.Errorf("Spec.SecurityProfile must be one of %q, %q or %q",
+			appcorev1.CliAppSecurityProfilePrivileged, appcorev1.CliAppSecurityProfileBaseline,
+			appcorev1.CliAppSecurityProfileRestricted)
+	}
+}
+
+func (r *CliAppReconciler) securityProfileOf(spec *appcorev1.CliAppSpec) appcorev1.CliAppSecurityProfile {
+	if len(spec.SecurityProfile) > 0 {
+		return spec.SecurityProfile
+	}
+
+	if len(r.DefaultSecurityProfile) > 0 {
+		return r.DefaultSecurityProfile
+	}
+
+	return appcorev1.CliAppSecurityProfilePrivileged
+}
+
+// checkVolumeSecurity checks whether volumes are allowed by the profile.
+func checkVolumeSecurity(volumes []corev1.Volume, profile appcorev1.CliAppSecurityProfile) error {
+	for i := range volumes {
+		v := &volumes[i]
+		if v.HostPath != nil {
+			return &securityProfileError{profile, fmt.Sprintf("volume %q is a hostPath", v.Name)}
+		}
+
+		if profile != appcorev1.CliAppSecurityProfileRestricted {
+			continue
+		}
+
+		if v.ConfigMap == nil && v.CSI == nil && v.DownwardAPI == nil && v.EmptyDir == nil && v.Ephemeral == nil &&
+			v.PersistentVolumeClaim == nil && v.Projected == nil && v.Secret == nil {
+			return &securityProfileError{profile, fmt.Sprintf("the type of volume %q is not allowed", v.Name)}
+		}
+	}
+
+	return nil
+}
+
+// validateSecurity checks whether features the app uses work under its security profile.
+func (r *CliAppReconciler) validateSecurity(spec *appcorev1.CliAppSpec) error {
+	profile := r.securityProfileOf(spec)
+	if profile == appcorev1.CliAppSecurityProfilePrivileged {
+		return nil
+	}
+
+	if !isNativeMode(spec) {
+		return &securityProfileError{profile, "the Chroot execution mode requires capability SYS_ADMIN"}
+	}
+
+	// Pre-pull Pods copy the app image in an init container as root via the InitContainer provider.
+	if spec.PrePull && profile == appcorev1.CliAppSecurityProfileRestricted {
+		provider, err := r.rootfsProviderOf(spec)
+		if err != nil {
+			return err
+		}
+
+		if provider == appcorev1.CliAppRootfsProviderInitContainer {
+			return &securityProfileError{profile, "pre-pulling images via the InitContainer rootfs provider runs as root"}
+		}
+	}
+
+	hostVolumes, _, err := parseHostPaths(spec)
+	if err != nil {
+		return err
+	}
+
+	appVolumes, _, err := parseVolumes(spec)
+	if err != nil {
+		return err
+	}
+
+	return checkVolumeSecurity(append(hostVolumes, appVolumes...), profile)
+}
+
+// checkPodSecurity checks whether the rendered Pod complies with the profile.
+// Forked workloads and Spec.PodTemplate may bring in fields the profile disallows.
+func checkPodSecurity(pod *corev1.Pod, profile appcorev1.CliAppSecurityProfile) error {
+	if profile == appcorev1.CliAppSecurityProfilePrivileged {
+		return nil
+	}
+
+	if pod.Spec.HostNetwork || pod.Spec.HostPID || pod.Spec.HostIPC {
+		return &securityProfileError{profile, "the Pod shares host namespaces"}
+	}
+
+	if err := checkVolumeSecurity(pod.Spec.Volumes, profile); err != nil {
+		return err
+	}
+
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for i := range containers {
+		c := &containers[i]
+		for _, port := range c.Ports {
+			if port.HostPort != 0 {
+				return &securityProfileError{profile, fmt.Sprintf("container %q uses host ports", c.Name)}
+			}
+		}
+
+		if profile == appcorev1.CliAppSecurityProfileRestricted {
+			if err := checkRestrictedContainer(pod, c); err != nil {
+				return err
+			}
+		}
+
+		sc := c.SecurityContext
+		if sc == nil {
+			continue
+		}
+
+		if sc.Privileged != nil && *sc.Privileged {
+			return &securityProfileError{profile, fmt.Sprintf("container %q is privileged", c.Name)}
+		}
+
+		if sc.Capabilities == nil {
+			continue
+		}
+
+		for _, capability := range sc.Capabilities.Add {
+			if !baselineCapabilities[capability] ||
+				profile == appcorev1.CliAppSecurityProfileRestricted && capability != "NET_BIND_SERVICE" {
+				return &securityProfileError{profile, fmt.Sprintf("container %q adds capability %s", c.Name,
+					capability)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkRestrictedContainer checks fields of the Restricted profile which are set by applySecurityProfile,
+// in case they are overridden or absent in containers the controller doesn't render.
+func checkRestrictedContainer(pod *corev1.Pod, c *corev1.Container) error {
+	profile := appcorev1.CliAppSecurityProfileRestricted
+	podSC := pod.Spec.SecurityContext
+	if podSC == nil {
+		podSC = &corev1.PodSecurityContext{}
+	}
+
+	sc := c.SecurityContext
+	if sc == nil {
+		sc = &corev1.SecurityContext{}
+	}
+
+	if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+		return &securityProfileError{profile, fmt.Sprintf("container %q allows privilege escalation", c.Name)}
+	}
+
+	dropAll := false
+	if sc.Capabilities != nil {
+		for _, capability := range sc.Capabilities.Drop {
+			dropAll = dropAll || capability == "ALL"
+		}
+	}
+
+	if !dropAll {
+		return &securityProfileError{profile, fmt.Sprintf("container %q doesn't drop all capabilities", c.Name)}
+	}
+
+	runAsNonRoot := podSC.RunAsNonRoot
+	if sc.RunAsNonRoot != nil {
+		runAsNonRoot = sc.RunAsNonRoot
+	}
+
+	if runAsNonRoot == nil || !*runAsNonRoot {
+		return &securityProfileError{profile, fmt.Sprintf("container %q may run as root", c.Name)}
+	}
+
+	runAsUser := podSC.RunAsUser
+	if sc.RunAsUser != nil {
+		runAsUser = sc.RunAsUser
+	}
+
+	if runAsUser != nil && *runAsUser == 0 {
+		return &securityProfileError{profile, fmt.Sprintf("container %q runs as root", c.Name)}
+	}
+
+	seccomp := podSC.SeccompProfile
+	if sc.SeccompProfile != nil {
+		seccomp = sc.SeccompProfile
+	}
+
+	if seccomp == nil || seccomp.Type != corev1.SeccompProfileTypeRuntimeDefault &&
+		seccomp.Type != corev1.SeccompProfileTypeLocalhost {
+		return &securityProfileError{profile, fmt.Sprintf("container %q is not confined by seccomp", c.Name)}
+	}
+
+	return nil
+}
+
+// isNonRootUser checks whether the image user is a non-root UID which kubelet is able to verify.
+func isNonRootUser(user string) bool {
+	uid, err := strconv.ParseInt(strings.SplitN(user, ":", 2)[0], 10, 64)
+	return err == nil && uid != 0
+}
+
+func restrictContainer(c *corev1.Container) {
+	if c.SecurityContext == nil {
+		c.SecurityContext = &corev1.SecurityContext{}
+	}
+
+	c.SecurityContext.AllowPrivilegeEscalation = new(bool)
+	c.SecurityContext.Capabilities = &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}}
+}
+
+// applySecurityProfile renders the Pod with the Restricted profile. Nothing needs to be changed for the others
+// since the workspace container adds no capabilities in the Native mode.
+// Init containers of the controller run as nonRootUser with read-only rootfs.
+func applySecurityProfile(
+	pod *corev1.Pod, container *corev1.Container, profile appcorev1.CliAppSecurityProfile, imageUser string,
+) {
+	if profile != appcorev1.CliAppSecurityProfileRestricted {
+		return
+	}
+
+	if pod.Spec.SecurityContext == nil {
+		pod.Spec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+
+	nonRoot := true
+	pod.Spec.SecurityContext.RunAsNonRoot = &nonRoot
+	pod.Spec.SecurityContext.SeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+
+	for i := range pod.Spec.InitContainers {
+		c := &pod.Spec.InitContainers[i]
+		if c.Name != nativeToolsContainer {
+			continue
+		}
+
+		restrictContainer(c)
+		uid := nonRootUser
+		c.SecurityContext.RunAsUser = &uid
+		c.SecurityContext.ReadOnlyRootFilesystem = &nonRoot
+	}
+
+	restrictContainer(container)
+	if container.SecurityContext.RunAsUser == nil && pod.Spec.SecurityContext.RunAsUser == nil &&
+		!isNonRootUser(imageUser) {
+		uid := nonRootUser
+		container.SecurityContext.RunAsUser = &uid
+	}
+}
+
+// checkSecurity validates the app against its security profile, and updates the condition.
+func (r *CliAppReconciler) checkSecurity(app *appcorev1.CliApp) error {
+	profile := r.securityProfileOf(&app.Spec)
+	if err := r.validateSecurity(&app.Spec); err != nil {
+		setCondition(app, appcorev1.CliAppConditionSecurityProfileSatisfied, metav1.ConditionFalse,
+			securityProfileViolatedReason, err.Error())
+		return err
+	}
+
+	setCondition(app, appcorev1.CliAppConditionSecurityProfileSatisfied, metav1.ConditionTrue, string(profile),
+		fmt.Sprintf("app works under the %s security profile", profile))
+	return nil
+}
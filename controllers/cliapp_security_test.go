@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("CliApp security profile", func() {
+	r := &CliAppReconciler{DefaultSecurityProfile: appcorev1.CliAppSecurityProfileRestricted}
+
+	It("should refuse features the profile disallows", func() {
+		Expect(r.validateSecurity(&appcorev1.CliAppSpec{})).To(HaveOccurred())
+		Expect(r.validateSecurity(&appcorev1.CliAppSpec{
+			SecurityProfile: appcorev1.CliAppSecurityProfilePrivileged,
+		})).To(Succeed())
+
+		native := appcorev1.CliAppSpec{ExecutionMode: appcorev1.CliAppExecutionModeNative}
+		Expect(r.validateSecurity(&native)).To(Succeed())
+
+		native.HostPath = []string{"/var/run/docker.sock"}
+		err := r.validateSecurity(&native)
+		profileErr := (*securityProfileError)(nil)
+		Expect(xerrors.As(err, &profileErr)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("hostPath"))
+
+		native.HostPath = nil
+		native.PrePull = true
+		native.RootfsProvider = appcorev1.CliAppRootfsProviderInitContainer
+		Expect(r.validateSecurity(&native)).To(HaveOccurred())
+		native.RootfsProvider = appcorev1.CliAppRootfsProviderCSIImage
+		Expect(r.validateSecurity(&native)).To(Succeed())
+	})
+
+	It("should check the rendered Pod", func() {
+		privileged := true
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:            "sidecar",
+			SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+		}}}}
+		Expect(checkPodSecurity(pod, appcorev1.CliAppSecurityProfilePrivileged)).To(Succeed())
+		Expect(checkPodSecurity(pod, appcorev1.CliAppSecurityProfileBaseline)).To(HaveOccurred())
+
+		pod.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{
+			Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"CHOWN"}},
+		}
+		Expect(checkPodSecurity(pod, appcorev1.CliAppSecurityProfileBaseline)).To(Succeed())
+		Expect(checkPodSecurity(pod, appcorev1.CliAppSecurityProfileRestricted)).To(HaveOccurred())
+	})
+
+	It("should render restricted Pods", func() {
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: appContainer}}}}
+		container := &pod.Spec.Containers[0]
+		r.installNativeTools(pod, container)
+		applySecurityProfile(pod, container, appcorev1.CliAppSecurityProfileRestricted, "root")
+		Expect(*pod.Spec.SecurityContext.RunAsNonRoot).To(BeTrue())
+		Expect(pod.Spec.SecurityContext.SeccompProfile.Type).To(Equal(corev1.SeccompProfileTypeRuntimeDefault))
+		Expect(*container.SecurityContext.RunAsUser).To(Equal(nonRootUser))
+		Expect(*container.SecurityContext.AllowPrivilegeEscalation).To(BeFalse())
+		Expect(container.SecurityContext.Capabilities.Drop).To(ConsistOf(corev1.Capability("ALL")))
+		Expect(*pod.Spec.InitContainers[0].SecurityContext.ReadOnlyRootFilesystem).To(BeTrue())
+		Expect(checkPodSecurity(pod, appcorev1.CliAppSecurityProfileRestricted)).To(Succeed())
+
+		pod = &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: appContainer}}}}
+		applySecurityProfile(pod, &pod.Spec.Containers[0], appcorev1.CliAppSecurityProfileRestricted, "1000:1000")
+		Expect(pod.Spec.Containers[0].SecurityContext.RunAsUser).To(BeNil())
+	})
+
+	It("should check all restricted fields of every container", func() {
+		restricted := func() *corev1.Pod {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: appContainer}}}}
+			applySecurityProfile(pod, &pod.Spec.Containers[0], appcorev1.CliAppSecurityProfileRestricted, "")
+			Expect(checkPodSecurity(pod, appcorev1.CliAppSecurityProfileRestricted)).To(Succeed())
+			return pod
+		}
+
+		root := int64(0)
+		escalation := true
+		for _, patch := range []func(pod *corev1.Pod){
+			func(pod *corev1.Pod) { pod.Spec.Containers[0].SecurityContext.RunAsUser = &root },
+			func(pod *corev1.Pod) { pod.Spec.SecurityContext.RunAsNonRoot = nil },
+			func(pod *corev1.Pod) { pod.Spec.Containers[0].SecurityContext.AllowPrivilegeEscalation = &escalation },
+			func(pod *corev1.Pod) { pod.Spec.Containers[0].SecurityContext.Capabilities = nil },
+			func(pod *corev1.Pod) {
+				pod.Spec.SecurityContext.SeccompProfile.Type = corev1.SeccompProfileTypeUnconfined
+			},
+			func(pod *corev1.Pod) {
+				pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "sidecar"})
+			},
+		} {
+			pod := restricted()
+			patch(pod)
+			Expect(checkPodSecurity(pod, appcorev1.CliAppSecurityProfileRestricted)).To(HaveOccurred())
+			Expect(checkPodSecurity(pod, appcorev1.CliAppSecurityProfileBaseline)).To(Succeed())
+		}
+	})
+})
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	configv1 "github.com/warm-metal/cliapp/pkg/apis/config/v1"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	shellContextConfigMap = "cliapp-shell-context"
+	shellAppRCVolume      = "shell-app-rc"
+	shellAppRCRefVolume   = "shell-app-rc-ref"
+
+	// directory the global rc and the rc ConfigMap of the app are mounted in if the app has its own rc.
+	shellRCDir = "/etc/cliapp/shell"
+
+	// annotation of the Pod which the rc of the app is projected from.
+	annoKeyShellRC = "cliapp.warm-metal.tech/shell-rc"
+
+	appShellRCFile = "rc"
+)
+
+var (
+	globalShellRCPath = filepath.Join(shellRCDir, "global.rc")
+	refShellRCPath    = filepath.Join(shellRCDir, "app.rc")
+)
+
+func validateShellRC(spec *appcorev1.CliAppSpec) error {
+	rc := spec.ShellRC
+	if rc == nil {
+		return nil
+	}
+
+	if isNativeMode(spec) {
+		return xerrors.Errorf("shellRC is not supported in the Native execution mode")
+	}
+
+	if len(rc.Inline) == 0 && rc.ConfigMapKeyRef == nil {
+		return xerrors.Errorf("specify either inline or configMapKeyRef in shellRC")
+	}
+
+	if rc.ConfigMapKeyRef != nil && (len(rc.ConfigMapKeyRef.Name) == 0 || len(rc.ConfigMapKeyRef.Key) == 0) {
+		return xerrors.Errorf("both name and key of shellRC.configMapKeyRef are required")
+	}
+
+	return nil
+}
+
+// appShellRC generates the rc of the app which sources files in order, with Inline in between.
+func appShellRC(shell *configv1.CliAppShellContext, globalRC bool, inline string, refRC bool) string {
+	source := shell.SourceCommand
+	if len(source) == 0 {
+		source = "."
+	}
+
+	var lines []string
+	if globalRC {
+		lines = append(lines, fmt.Sprintf("%s %s", source, globalShellRCPath))
+	}
+
+	if len(inline) > 0 {
+		lines = append(lines, strings.TrimSuffix(inline, "\n"))
+	}
+
+	if refRC {
+		lines = append(lines, fmt.Sprintf("%s %s", source, refShellRCPath))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// installAppShellRC mounts the rc of the app at the rc file of the shell. The rc is projected from an annotation
+// of the Pod, and sources the global rc and the ConfigMap the app refers to.
+func (r *CliAppReconciler) installAppShellRC(
+	ctx context.Context, pod *corev1.Pod, container *corev1.Container, app *appcorev1.CliApp,
+	shell *configv1.CliAppShellContext, globalRC bool,
+) error {
+	if len(shell.RCFile) == 0 {
+		return xerrors.Errorf("shell %s has no rc file to install shellRC", app.Status.Shell)
+	}
+
+	refRC := false
+	if ref := app.Spec.ShellRC.ConfigMapKeyRef; ref != nil {
+		optional := ref.Optional != nil && *ref.Optional
+		cm := &corev1.ConfigMap{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: app.Namespace, Name: ref.Name}, cm)
+		if err != nil && (!optional || !errors.IsNotFound(err)) {
+			return xerrors.Errorf("unable to fetch ConfigMap %s of shellRC: %s", ref.Name, err)
+		}
+
+		_, refRC = cm.Data[ref.Key]
+		if err == nil && !refRC && !optional {
+			return xerrors.Errorf("key %s is not found in ConfigMap %s of shellRC", ref.Key, ref.Name)
+		}
+	}
+
+	if refRC {
+		ref := app.Spec.ShellRC.ConfigMapKeyRef
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: shellAppRCRefVolume,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: ref.LocalObjectReference,
+					Items: []corev1.KeyToPath{
+						{Key: ref.Key, Path: filepath.Base(refShellRCPath)},
+					},
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      shellAppRCRefVolume,
+			MountPath: refShellRCPath,
+			SubPath:   filepath.Base(refShellRCPath),
+		})
+	}
+
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+
+	pod.Annotations[annoKeyShellRC] = appShellRC(shell, globalRC, app.Spec.ShellRC.Inline, refRC)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: shellAppRCVolume,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{
+					{
+						Path: appShellRCFile,
+						FieldRef: &corev1.ObjectFieldSelector{
+							FieldPath: fmt.Sprintf("metadata.annotations['%s']", annoKeyShellRC),
+						},
+					},
+				},
+			},
+		},
+	})
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      shellAppRCVolume,
+		MountPath: filepath.Join(shellHome, shell.RCFile),
+		SubPath:   appShellRCFile,
+	})
+
+	return nil
+}
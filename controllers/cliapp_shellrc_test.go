@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("CliApp shell rc", func() {
+	appRC := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "kubectl-rc"},
+		Data:       map[string]string{"rc": "alias k=kubectl"},
+	}
+
+	r := &CliAppReconciler{
+		Client:              fake.NewClientBuilder().WithObjects(appRC).Build(),
+		ControllerNamespace: "cliapp",
+	}
+
+	newApp := func(rc *appcorev1.CliAppShellRC) *appcorev1.CliApp {
+		app := &appcorev1.CliApp{Spec: appcorev1.CliAppSpec{ShellRC: rc}}
+		app.Namespace = "default"
+		app.Name = "kubectl"
+		return app
+	}
+
+	It("should validate shellRC", func() {
+		Expect(validateShellRC(&appcorev1.CliAppSpec{ShellRC: &appcorev1.CliAppShellRC{Inline: "alias k=kubectl"}})).
+			To(Succeed())
+		Expect(validateShellRC(&appcorev1.CliAppSpec{ShellRC: &appcorev1.CliAppShellRC{}})).NotTo(Succeed())
+		Expect(validateShellRC(&appcorev1.CliAppSpec{
+			ShellRC:       &appcorev1.CliAppShellRC{Inline: "alias k=kubectl"},
+			ExecutionMode: appcorev1.CliAppExecutionModeNative,
+		})).NotTo(Succeed())
+	})
+
+	It("should layer the app rc on top of the global rc", func() {
+		bash := BuiltinShells[appcorev1.CliAppShellBash]
+		app := newApp(&appcorev1.CliAppShellRC{
+			Inline: `PS1="[$CLIAPP_NAMESPACE/$CLIAPP_NAME] $PS1"`,
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "kubectl-rc"},
+				Key:                  "rc",
+			},
+		})
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{}}}}
+		cm := &corev1.ConfigMap{Data: map[string]string{".bash_profile": "export EDITOR=vi"}}
+		Expect(r.installShellContext(context.TODO(), pod, &pod.Spec.Containers[0], app, cm, &bash)).To(Succeed())
+
+		Expect(pod.Annotations[annoKeyShellRC]).To(Equal(". /etc/cliapp/shell/global.rc\n" +
+			`PS1="[$CLIAPP_NAMESPACE/$CLIAPP_NAME] $PS1"` + "\n. /etc/cliapp/shell/app.rc\n"))
+
+		mounts := map[string]string{}
+		for _, m := range pod.Spec.Containers[0].VolumeMounts {
+			mounts[m.MountPath] = m.Name
+		}
+
+		Expect(mounts).To(Equal(map[string]string{
+			"/etc/cliapp/shell/global.rc": shellRCVolume,
+			"/etc/cliapp/shell/app.rc":    shellAppRCRefVolume,
+			"/root/.bash_profile":         shellAppRCVolume,
+		}))
+	})
+
+	It("should fail if the referred ConfigMap is missing unless it is optional", func() {
+		fish := BuiltinShells[appcorev1.CliAppShellFish]
+		ref := &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Key: "rc"}
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{}}}}
+		app := newApp(&appcorev1.CliAppShellRC{ConfigMapKeyRef: ref})
+		Expect(r.installShellContext(context.TODO(), pod, &pod.Spec.Containers[0], app, nil, &fish)).NotTo(Succeed())
+
+		optional := true
+		ref.Optional = &optional
+		pod = &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{}}}}
+		app = newApp(&appcorev1.CliAppShellRC{Inline: "set -g fish_greeting", ConfigMapKeyRef: ref})
+		Expect(r.installShellContext(context.TODO(), pod, &pod.Spec.Containers[0], app, nil, &fish)).To(Succeed())
+		Expect(pod.Annotations[annoKeyShellRC]).To(Equal("set -g fish_greeting\n"))
+		Expect(pod.Spec.Containers[0].VolumeMounts).To(HaveLen(1))
+		Expect(pod.Spec.Containers[0].VolumeMounts[0].MountPath).To(Equal("/root/.config/fish/config.fish"))
+	})
+})
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	toolsRoot           = "/app-tools"
+	toolVolumePrefix    = "tool-"
+	toolContainerPrefix = "tool-"
+	maxToolImageNameLen = validation.DNS1123LabelMaxLength - len(toolVolumePrefix)
+)
+
+func validateToolImages(spec *appcorev1.CliAppSpec) error {
+	if len(spec.ToolImages) == 0 {
+		return nil
+	}
+
+	if isNativeMode(spec) {
+		return xerrors.Errorf("toolImages are not supported in the Native execution mode")
+	}
+
+	names := make(map[string]bool, len(spec.ToolImages))
+	for _, tool := range spec.ToolImages {
+		if len(validation.IsDNS1123Label(tool.Name)) > 0 || len(tool.Name) > maxToolImageNameLen {
+			return xerrors.Errorf("tool image name %q must be a DNS label no longer than %d characters",
+				tool.Name, maxToolImageNameLen)
+		}
+
+		if names[tool.Name] {
+			return xerrors.Errorf("tool image name %q is duplicated", tool.Name)
+		}
+
+		if len(tool.Image) == 0 {
+			return xerrors.Errorf("image of tool %q is empty", tool.Name)
+		}
+
+		names[tool.Name] = true
+	}
+
+	return nil
+}
+
+func toolRootOf(name string) string {
+	return filepath.Join(toolsRoot, name)
+}
+
+// rootedPaths converts PATH of an image to directories under the root.
+func rootedPaths(root, path string) []string {
+	if len(path) == 0 {
+		return nil
+	}
+
+	dirs := strings.Split(path, ":")
+	paths := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if len(dir) > 0 {
+			paths = append(paths, filepath.Join(root, dir))
+		}
+	}
+
+	return paths
+}
+
+// installToolImages mounts tool images of the app to the container. Each image is also mounted at the same path
+// in the app rootfs, so that chrooted commands could run tools. It returns PATH of all tool images in order.
+func (r *CliAppReconciler) installToolImages(
+	ctx context.Context, log logr.Logger, pod *corev1.Pod, container *corev1.Container, app *appcorev1.CliApp,
+	provider appcorev1.CliAppRootfsProvider,
+) (paths []string, err error) {
+	var config imageConfiguration
+	app.Status.ToolImages = nil
+	for _, tool := range app.Spec.ToolImages {
+		image := pinnedImageOf(r.rewriteImage(tool.Image), app.Status.PinnedImages)
+		config, err = r.fetchImageConfiguration(ctx, log, app, pod, image)
+		if err != nil {
+			return nil, xerrors.Errorf("unable to fetch configuration of tool image %s: %s", tool.Name, err)
+		}
+
+		root := toolRootOf(tool.Name)
+		err = installImage(pod, container, provider, toolVolumePrefix+tool.Name, root, toolContainerPrefix+tool.Name,
+			image)
+		if err != nil {
+			return nil, err
+		}
+
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      toolVolumePrefix + tool.Name,
+			MountPath: filepath.Join(appRoot, root),
+		})
+
+		paths = append(paths, rootedPaths(root, config.Path)...)
+		app.Status.ToolImages = append(app.Status.ToolImages, appcorev1.CliAppToolImageStatus{
+			Name:   tool.Name,
+			Image:  image,
+			Digest: config.Digest,
+			Path:   config.Path,
+		})
+	}
+
+	return
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("CliApp tool images", func() {
+	It("should validate tool images", func() {
+		spec := &appcorev1.CliAppSpec{ToolImages: []appcorev1.CliAppToolImage{
+			{Name: "helm", Image: "alpine/helm"},
+			{Name: "jq", Image: "stedolan/jq"},
+		}}
+		Expect(validateToolImages(spec)).To(Succeed())
+
+		spec.ToolImages[1].Name = "helm"
+		Expect(validateToolImages(spec)).To(HaveOccurred())
+
+		spec.ToolImages[1].Name = "JQ"
+		Expect(validateToolImages(spec)).To(HaveOccurred())
+
+		spec.ToolImages[1].Name = "jq"
+		spec.ExecutionMode = appcorev1.CliAppExecutionModeNative
+		Expect(validateToolImages(spec)).To(HaveOccurred())
+	})
+
+	It("should mount tool images at their own roots", func() {
+		Expect(rootedPaths(toolRootOf("helm"), "/usr/bin::/bin")).To(Equal([]string{
+			"/app-tools/helm/usr/bin", "/app-tools/helm/bin",
+		}))
+
+		pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: appContainer}}}}
+		container := &pod.Spec.Containers[0]
+		Expect(installRootfs(pod, container, appcorev1.CliAppRootfsProviderImageVolume, "kubectl")).To(Succeed())
+		Expect(installImage(pod, container, appcorev1.CliAppRootfsProviderImageVolume, toolVolumePrefix+"helm",
+			toolRootOf("helm"), toolContainerPrefix+"helm", "alpine/helm")).To(Succeed())
+		Expect(pod.Annotations).To(HaveKeyWithValue(annoKeyImageVolume, `{"app":"kubectl","tool-helm":"alpine/helm"}`))
+		Expect(container.VolumeMounts[1].MountPath).To(Equal("/app-tools/helm"))
+
+		pod = &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: appContainer}}}}
+		Expect(installImage(pod, &pod.Spec.Containers[0], appcorev1.CliAppRootfsProviderInitContainer,
+			toolVolumePrefix+"helm", toolRootOf("helm"), toolContainerPrefix+"helm", "alpine/helm")).To(Succeed())
+		Expect(pod.Spec.InitContainers[0].Name).To(Equal("tool-helm"))
+		Expect(pod.Spec.InitContainers[0].Command[2]).To(ContainSubstring("|app-tools|"))
+
+		pod = &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: appContainer}}}}
+		pod.Annotations = map[string]string{annoKeyImageVolume: "kubectl"}
+		Expect(installImage(pod, &pod.Spec.Containers[0], appcorev1.CliAppRootfsProviderImageVolume,
+			toolVolumePrefix+"helm", toolRootOf("helm"), toolContainerPrefix+"helm", "alpine/helm")).NotTo(Succeed())
+	})
+
+	It("should look up commands in the rootfs with PATH of tool images", func() {
+		spec := &appcorev1.CliAppSpec{
+			Command:    []string{"helm"},
+			ToolImages: []appcorev1.CliAppToolImage{{Name: "helm", Image: "alpine/helm"}},
+		}
+		probe := commandProbe(spec, &imageConfiguration{}, []string{"/app-tools/helm/usr/bin"})
+		Expect(probe.Exec.Command[2]).To(ContainSubstring("'/app-root/app-tools/helm/usr/bin/helm'"))
+		Expect(probe.Exec.Command[2]).To(ContainSubstring("'/app-root/usr/bin/helm'"))
+	})
+
+	It("should refuse tool images in read-only rootfs", func() {
+		spec := &appcorev1.CliAppSpec{ToolImages: []appcorev1.CliAppToolImage{{Name: "helm", Image: "alpine/helm"}}}
+		r := &CliAppReconciler{DefaultRootfsProvider: appcorev1.CliAppRootfsProviderImageVolume}
+		Expect(r.checkRootfsMounts(spec, "toolImages")).NotTo(Succeed())
+
+		spec.RootfsProvider = appcorev1.CliAppRootfsProviderCSIImage
+		Expect(r.checkRootfsMounts(spec, "toolImages")).To(Succeed())
+	})
+})
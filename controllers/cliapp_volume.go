@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	configv1 "github.com/warm-metal/cliapp/pkg/apis/config/v1"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	shellRCVolume        = "shell-rc"
+	hostPathVolumePrefix = "hostpath-"
+	shellHome            = "/root"
+)
+
+func parseHostPaths(spec *appcorev1.CliAppSpec) (volumes []corev1.Volume, mounts []corev1.VolumeMount, err error) {
+	for i, path := range spec.HostPath {
+		mountPair := strings.Split(strings.TrimSpace(path), ":")
+		if len(mountPair) == 0 {
+			return nil, nil, xerrors.Errorf("invalid hostpath spec")
+		}
+
+		hostpath := strings.TrimSpace(mountPair[0])
+		if !filepath.IsAbs(hostpath) {
+			return nil, nil, xerrors.Errorf("hostpath can't be empty")
+		}
+
+		mountpoint := hostpath
+		if len(mountPair) > 1 {
+			mountpoint = strings.TrimSpace(mountPair[1])
+			if !filepath.IsAbs(mountpoint) {
+				return nil, nil, xerrors.Errorf("mountpoint must be an absolute path")
+			}
+		}
+
+		volume := fmt.Sprintf("%s%d", hostPathVolumePrefix, i)
+		volumes = append(volumes, corev1.Volume{
+			Name: volume,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: hostpath,
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      volume,
+			MountPath: mountpoint,
+		})
+	}
+
+	return
+}
+
+func isReservedVolumeName(name string) bool {
+	return name == appImageVolume || name == shellRCVolume ||
+		name == shellAppRCVolume || name == shellAppRCRefVolume || name == nativeToolsVolume ||
+		strings.HasPrefix(name, toolVolumePrefix) || strings.HasPrefix(name, hostPathVolumePrefix)
+}
+
+func isReservedMountPath(path string) bool {
+	// Volumes under the app rootfs would shadow files of the app image.
+	if path == "/" || path == appRoot || strings.HasPrefix(path, appRoot+"/") || path == nativeToolsDir ||
+		path == toolsRoot || strings.HasPrefix(path, toolsRoot+"/") ||
+		path == shellRCDir || strings.HasPrefix(path, shellRCDir+"/") {
+		return true
+	}
+
+	// Files of configured shells are checked while rendering the Pod.
+	for _, shell := range BuiltinShells {
+		for _, file := range shellContextFilesOf(&shell) {
+			if path == file {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func volumeSourceOf(v *appcorev1.CliAppVolume) (source corev1.VolumeSource, numSources int) {
+	if v.HostPath != nil {
+		source.HostPath = v.HostPath
+		numSources++
+	}
+
+	if v.PersistentVolumeClaim != nil {
+		source.PersistentVolumeClaim = v.PersistentVolumeClaim
+		numSources++
+	}
+
+	if v.Secret != nil {
+		source.Secret = v.Secret
+		numSources++
+	}
+
+	if v.ConfigMap != nil {
+		source.ConfigMap = v.ConfigMap
+		numSources++
+	}
+
+	if v.EmptyDir != nil {
+		source.EmptyDir = v.EmptyDir
+		numSources++
+	}
+
+	return
+}
+
+// parseVolumes validates Spec.Volumes and converts them to Pod volumes and mounts of the workspace container.
+// Mount points of Spec.HostPath are also checked to avoid collision.
+func parseVolumes(spec *appcorev1.CliAppSpec) (volumes []corev1.Volume, mounts []corev1.VolumeMount, err error) {
+	_, hostMounts, err := parseHostPaths(spec)
+	if err != nil {
+		return
+	}
+
+	names := make(map[string]bool, len(spec.Volumes))
+	mountPaths := make(map[string]string, len(spec.Volumes)+len(hostMounts))
+	for _, m := range hostMounts {
+		mountPaths[filepath.Clean(m.MountPath)] = m.Name
+	}
+
+	for i := range spec.Volumes {
+		v := &spec.Volumes[i]
+		if errs := validation.IsDNS1123Label(v.Name); len(errs) > 0 {
+			return nil, nil, xerrors.Errorf("invalid volume name %q: %s", v.Name, strings.Join(errs, ","))
+		}
+
+		if isReservedVolumeName(v.Name) {
+			return nil, nil, xerrors.Errorf("volume name %q is reserved", v.Name)
+		}
+
+		if names[v.Name] {
+			return nil, nil, xerrors.Errorf("volume %q is defined more than once", v.Name)
+		}
+
+		names[v.Name] = true
+
+		if !filepath.IsAbs(v.MountPath) {
+			return nil, nil, xerrors.Errorf("mountPath of volume %q must be an absolute path", v.Name)
+		}
+
+		mountPath := filepath.Clean(v.MountPath)
+		if isReservedMountPath(mountPath) {
+			return nil, nil, xerrors.Errorf("volume %q can't be mounted to %q", v.Name, mountPath)
+		}
+
+		if another, found := mountPaths[mountPath]; found {
+			return nil, nil, xerrors.Errorf("volume %q and %q are mounted to the same path %q",
+				v.Name, another, mountPath)
+		}
+
+		mountPaths[mountPath] = v.Name
+
+		source, numSources := volumeSourceOf(v)
+		if numSources != 1 {
+			return nil, nil, xerrors.Errorf("specify exactly one source for volume %q", v.Name)
+		}
+
+		volumes = append(volumes, corev1.Volume{
+			Name:         v.Name,
+			VolumeSource: source,
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:             v.Name,
+			MountPath:        mountPath,
+			SubPath:          v.SubPath,
+			ReadOnly:         v.ReadOnly,
+			MountPropagation: v.MountPropagation,
+		})
+	}
+
+	return
+}
+
+// checkVolumeConflicts checks whether volumes of a forked workload conflict with volumes the app will add.
+func checkVolumeConflicts(pod *corev1.Pod, volumes []corev1.Volume) error {
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == appImageVolume || v.Name == shellRCVolume ||
+			v.Name == shellAppRCVolume || v.Name == shellAppRCRefVolume || v.Name == nativeToolsVolume ||
+			strings.HasPrefix(v.Name, toolVolumePrefix) {
+			return xerrors.Errorf("volume %q of the forked workload conflicts with the app", v.Name)
+		}
+
+		for _, appVolume := range volumes {
+			if v.Name == appVolume.Name {
+				return xerrors.Errorf("volume %q conflicts with volumes of the forked workload", v.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkShellContextConflicts checks whether mounts of the container conflict with files of the shell context.
+func checkShellContextConflicts(container *corev1.Container, shell *configv1.CliAppShellContext) error {
+	for _, file := range shellContextFilesOf(shell) {
+		for _, mount := range container.VolumeMounts {
+			if mount.MountPath == file {
+				return xerrors.Errorf("mount path %q is reserved for the shell context", file)
+			}
+		}
+	}
+
+	return nil
+}
@@ -2,10 +2,10 @@ package controllers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/go-logr/logr"
 	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	configv1 "github.com/warm-metal/cliapp/pkg/apis/config/v1"
 	"golang.org/x/xerrors"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -13,8 +13,6 @@ import (
 	"k8s.io/apimachinery/pkg/util/rand"
 	"path/filepath"
 	"strings"
-
-	cri "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 )
 
 const (
@@ -27,6 +25,10 @@ func (r *CliAppReconciler) startApp(
 	targetContainerID := 0
 	if app.Spec.Fork != nil {
 		pod, targetContainerID, err = r.fetchForkTargetPod(app.Namespace, app.Spec.Fork)
+		if err == nil {
+			targetContainer := &pod.Spec.Containers[targetContainerID]
+			targetContainer.Image = r.rewriteImage(targetContainer.Image)
+		}
 	} else {
 		pod, err = r.convertToManifest(app)
 	}
@@ -38,11 +40,11 @@ func (r *CliAppReconciler) startApp(
 
 	shellContextCM := &corev1.ConfigMap{}
 	err = r.Get(ctx, types.NamespacedName{
-		Namespace: "cliapp-system",
-		Name:      "cliapp-shell-context",
+		Namespace: r.ControllerNamespace,
+		Name:      shellContextConfigMap,
 	}, shellContextCM)
 	if err != nil {
-		log.Error(err, "unable to fetch configmap", "cm", "cliapp-shell-context")
+		log.Error(err, "unable to fetch configmap", "cm", shellContextConfigMap, "namespace", r.ControllerNamespace)
 		shellContextCM = nil
 	}
 
@@ -50,6 +52,24 @@ func (r *CliAppReconciler) startApp(
 		return
 	}
 
+	homeUsers := r.mountedHomeUsers(app)
+	installUserHomes(pod, &pod.Spec.Containers[targetContainerID], homeUsers)
+
+	if pod, err = applyPodTemplate(pod, app); err != nil {
+		return
+	}
+
+	// The template could change resources of the workspace container.
+	if err = validateResources(&workspaceContainerOf(pod).Resources, r.MaxResources); err != nil {
+		return
+	}
+
+	if err = checkPodSecurity(pod, r.securityProfileOf(&app.Spec)); err != nil {
+		setCondition(app, appcorev1.CliAppConditionSecurityProfileSatisfied, metav1.ConditionFalse,
+			securityProfileViolatedReason, err.Error())
+		return
+	}
+
 	if pod.Annotations == nil {
 		pod.Annotations = map[string]string{}
 	}
@@ -57,8 +77,12 @@ func (r *CliAppReconciler) startApp(
 	pod.Annotations[annoKeySpecDump] = specDump
 	pod.Annotations[annoKeySpecHash] = specHash
 
+	if err = r.ensureUserHomes(ctx, log, app.Namespace, homeUsers); err != nil {
+		return
+	}
+
 	log.Info("create pod", "pod", pod.Name, "namespace", pod.Namespace, "labels", pod.Labels)
-	if err = r.Create(ctx, pod); err != nil {
+	if err = r.createPod(ctx, pod); err != nil {
 		log.Error(err, "unable to create pod")
 	}
 
@@ -74,6 +98,9 @@ const (
 	csiConfigMapDriverName = "csi-cm.warm-metal.tech"
 	annoKeySpecHash        = "cliapp.warm-metal.tech/spec-hash"
 	annoKeySpecDump        = "cliapp.warm-metal.tech/spec"
+	annoKeySessions        = "cliapp.warm-metal.tech/sessions"
+	annoKeySessionsRenewed = "cliapp.warm-metal.tech/sessions-renewed-at"
+	annoKeyRetiredAt       = "cliapp.warm-metal.tech/retired-at"
 )
 
 func (r *CliAppReconciler) convertToManifest(app *appcorev1.CliApp) (*corev1.Pod, error) {
@@ -81,7 +108,7 @@ func (r *CliAppReconciler) convertToManifest(app *appcorev1.CliApp) (*corev1.Pod
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{
 				{
-					Image: app.Spec.Image,
+					Image: pinnedImageOf(r.rewriteImage(app.Spec.Image), app.Status.PinnedImages),
 				},
 			},
 		},
@@ -90,79 +117,77 @@ func (r *CliAppReconciler) convertToManifest(app *appcorev1.CliApp) (*corev1.Pod
 
 var enabled = true
 
-func (r *CliAppReconciler) applyAppConfig(
-	ctx context.Context, log logr.Logger, pod *corev1.Pod, targetContainerID int, app *appcorev1.CliApp,
-	shellCtxCM *corev1.ConfigMap,
-) error {
-	var hostVolumes []corev1.Volume
-	var hostMounts []corev1.VolumeMount
-
-	for i, path := range app.Spec.HostPath {
-		mountPair := strings.Split(strings.TrimSpace(path), ":")
-		if len(mountPair) == 0 {
-			return xerrors.Errorf("invalid hostpath spec")
+// appContextOf returns the shell, the distro and the context image of the app.
+func (r *CliAppReconciler) appContextOf(spec *appcorev1.CliAppSpec) (
+	sh appcorev1.CliAppShell, distro appcorev1.CliAppDistro, ctxImage string,
+) {
+	sh = r.DefaultShell
+	distro = r.DefaultDistro
+	ctxImage = r.DefaultAppContextImage
+	if len(ctxImage) == 0 {
+		if len(spec.Shell) > 0 {
+			sh = spec.Shell
 		}
 
-		hostpath := strings.TrimSpace(mountPair[0])
-		if !filepath.IsAbs(hostpath) {
-			return xerrors.Errorf("hostpath can't be empty")
+		if len(spec.Distro) > 0 {
+			distro = spec.Distro
 		}
 
-		mountpoint := hostpath
-		if len(mountPair) > 1 {
-			mountpoint = strings.TrimSpace(mountPair[1])
-			if !filepath.IsAbs(mountpoint) {
-				return xerrors.Errorf("mountpoint must be an absolute path")
-			}
+		if distroCtx, found := r.distros()[distro]; found {
+			ctxImage = contextImageOf(&distroCtx, sh)
+		} else {
+			ctxImage = fmt.Sprintf(appContextImage, strings.ToLower(string(sh)), strings.ToLower(string(distro)))
 		}
+	}
 
-		volume := fmt.Sprintf("hostpath-%d", i)
-		hostVolumes = append(hostVolumes, corev1.Volume{
-			Name: volume,
-			VolumeSource: corev1.VolumeSource{
-				HostPath: &corev1.HostPathVolumeSource{
-					Path: hostpath,
+	ctxImage = r.rewriteImage(ctxImage)
+	return
+}
+
+func appImageVolumeOf(image string) corev1.Volume {
+	return corev1.Volume{
+		Name: appImageVolume,
+		VolumeSource: corev1.VolumeSource{
+			CSI: &corev1.CSIVolumeSource{
+				Driver: csiImageDriverName,
+				VolumeAttributes: map[string]string{
+					"image": image,
 				},
 			},
-		})
-		hostMounts = append(hostMounts, corev1.VolumeMount{
-			Name:      volume,
-			MountPath: mountpoint,
-		})
+		},
 	}
+}
 
-	var envs []corev1.EnvVar
-	for _, kv := range app.Spec.Env {
-		envPair := strings.Split(kv, "=")
-		if len(envPair) != 2 {
-			return xerrors.Errorf(`environment variable must be in the form of "key=value"`)
-		}
-
-		env := corev1.EnvVar{
-			Name:  strings.TrimSpace(envPair[0]),
-			Value: strings.TrimSpace(envPair[1]),
-		}
-
-		if len(env.Name) == 0 {
-			return xerrors.Errorf(`the key of environment variable must be not empty`)
-		}
+func (r *CliAppReconciler) applyAppConfig(
+	ctx context.Context, log logr.Logger, pod *corev1.Pod, targetContainerID int, app *appcorev1.CliApp,
+	shellCtxCM *corev1.ConfigMap,
+) error {
+	hostVolumes, hostMounts, err := parseHostPaths(&app.Spec)
+	if err != nil {
+		return err
+	}
 
-		envs = append(envs, env)
+	appVolumes, appMounts, err := parseVolumes(&app.Spec)
+	if err != nil {
+		return err
 	}
 
-	sh := r.DefaultShell
-	distro := r.DefaultDistro
-	ctxImage := r.DefaultAppContextImage
-	if len(ctxImage) == 0 {
-		if len(app.Spec.Shell) > 0 {
-			sh = app.Spec.Shell
-		}
+	if err = checkVolumeConflicts(pod, append(hostVolumes, appVolumes...)); err != nil {
+		return err
+	}
 
-		if len(app.Spec.Distro) > 0 {
-			distro = app.Spec.Distro
-		}
+	envs, err := parseEnvs(&app.Spec)
+	if err != nil {
+		return err
+	}
 
-		ctxImage = fmt.Sprintf(appContextImage, strings.ToLower(string(sh)), strings.ToLower(string(distro)))
+	native := isNativeMode(&app.Spec)
+	sh, distro, ctxImage := r.appContextOf(&app.Spec)
+	var rootfsProvider appcorev1.CliAppRootfsProvider
+	if native {
+		sh, distro, ctxImage = "", "", ""
+	} else if rootfsProvider, err = r.rootfsProviderOf(&app.Spec); err != nil {
+		return err
 	}
 
 	pod.ObjectMeta.Name = fmt.Sprintf("%s-%s", app.Name, rand.String(5))
@@ -185,84 +210,137 @@ func (r *CliAppReconciler) applyAppConfig(
 
 	targetContainer := &pod.Spec.Containers[targetContainerID]
 
-	// exchange the target image
+	// exchange the target image. The app image runs as is in the Native mode.
 	targetImage := targetContainer.Image
-	targetContainer.Image = ctxImage
+	if !native {
+		targetContainer.Image = pinnedImageOf(ctxImage, app.Status.PinnedImages)
+	}
 
 	// update the target container name
 	targetContainer.Name = appContainer
 
 	// append envs
-	targetContainer.Env = append(targetContainer.Env, corev1.EnvVar{
-		Name:  "APP_ROOT",
-		Value: appRoot,
-	}, corev1.EnvVar{
-		Name:  "DISTRO",
-		Value: string(distro),
-	}, corev1.EnvVar{
-		Name:  "SHELL",
-		Value: string(sh),
-	})
-
-	workdir, paths, err := r.fetchImageConfiguration(ctx, log, targetImage)
+	if !native {
+		targetContainer.Env = append(targetContainer.Env, corev1.EnvVar{
+			Name:  "APP_ROOT",
+			Value: appRoot,
+		}, corev1.EnvVar{
+			Name:  "DISTRO",
+			Value: string(distro),
+		}, corev1.EnvVar{
+			Name:  "SHELL",
+			Value: string(sh),
+		}, corev1.EnvVar{
+			Name:  "CLIAPP_NAME",
+			Value: app.Name,
+		}, corev1.EnvVar{
+			Name:  "CLIAPP_NAMESPACE",
+			Value: app.Namespace,
+		})
+	}
+
+	pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, app.Spec.ImagePullSecrets...)
+	imageConfig, err := r.fetchImageConfiguration(ctx, log, app, pod, targetImage)
 	if err != nil {
 		return err
 	}
 
-	log.Info("spec of image", "image", targetImage, "workdir", workdir, "path", paths)
+	log.Info("spec of image", "image", targetImage, "workdir", imageConfig.WorkingDir, "path", imageConfig.Path,
+		"user", imageConfig.User, "entrypoint", imageConfig.Entrypoint, "cmd", imageConfig.Cmd,
+		"digest", imageConfig.Digest)
+
+	shellCtx := r.shells()[sh]
+	app.Status.Distro = distro
+	app.Status.Shell = sh
+	app.Status.ShellCommand = shellCtx.LoginCommand
+	app.Status.ShellHistoryEnv = shellCtx.HistoryEnv
+	app.Status.ContextImage = ctxImage
+	app.Status.Image = targetImage
+	app.Status.RootfsProvider = rootfsProvider
+	app.Status.SecurityProfile = r.securityProfileOf(&app.Spec)
+	app.Status.ImageDigest = imageConfig.Digest
+	app.Status.ImageConfig = imageConfig.CliAppImageConfig.DeepCopy()
+	if !r.distros()[distro].ChrootUserspec {
+		// Commands in the rootfs can't switch to the image user.
+		app.Status.ImageConfig.User = ""
+	}
 
-	if paths != "" {
-		pathArray := strings.Split(paths, ":")
-		envPaths := make([]string, len(pathArray))
-		for i := range pathArray {
-			envPaths[i] = filepath.Join(appRoot, pathArray[i])
+	// The container runtime applies the image config in the Native mode.
+	var toolPaths []string
+	if !native {
+		// PATH of tool images goes after the app image in order.
+		envPaths := rootedPaths(appRoot, imageConfig.Path)
+		toolPaths, err = r.installToolImages(ctx, log, pod, targetContainer, app, rootfsProvider)
+		if err != nil {
+			return err
 		}
 
-		targetContainer.Env = append(targetContainer.Env, corev1.EnvVar{
-			Name:  "PATH",
-			Value: "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:" + strings.Join(envPaths, ":"),
-		})
+		envPaths = append(envPaths, toolPaths...)
+		if len(envPaths) > 0 {
+			targetContainer.Env = append(targetContainer.Env, corev1.EnvVar{
+				Name:  "PATH",
+				Value: defaultPath + ":" + strings.Join(envPaths, ":"),
+			})
+		}
+
+		if targetContainer.WorkingDir == "" && imageConfig.WorkingDir != "" {
+			targetContainer.WorkingDir = filepath.Join(appRoot, imageConfig.WorkingDir)
+		}
+
+		// variables of the image go before those of the app so that the app can override them
+		targetContainer.Env = append(targetContainer.Env, imageEnvs(imageConfig.Env)...)
 	}
 
-	if targetContainer.WorkingDir == "" && workdir != "" {
-		targetContainer.WorkingDir = filepath.Join(appRoot, workdir)
+	if probe := commandProbe(&app.Spec, &imageConfig, toolPaths); probe != nil {
+		targetContainer.StartupProbe = probe
 	}
 
 	targetContainer.Env = append(targetContainer.Env, envs...)
+	targetContainer.EnvFrom = append(targetContainer.EnvFrom, app.Spec.EnvFrom...)
 	targetContainer.Stdin = true
 
+	// resources of the forked container take precedence over the defaults
+	targetContainer.Resources = mergeResources(r.DefaultResources, targetContainer.Resources, app.Spec.Resources)
+	if err = validateResources(&targetContainer.Resources, r.MaxResources); err != nil {
+		return err
+	}
+
 	// hostpaths
 	pod.Spec.Volumes = append(pod.Spec.Volumes, hostVolumes...)
 	targetContainer.VolumeMounts = append(targetContainer.VolumeMounts, hostMounts...)
 
+	// app volumes
+	pod.Spec.Volumes = append(pod.Spec.Volumes, appVolumes...)
+	targetContainer.VolumeMounts = append(targetContainer.VolumeMounts, appMounts...)
+
+	// Neither the shell context nor extra privileges are needed in the Native mode.
+	if native {
+		r.installNativeTools(pod, targetContainer)
+		if targetContainer.SecurityContext == nil {
+			targetContainer.SecurityContext = &corev1.SecurityContext{}
+		}
+
+		if targetContainer.SecurityContext.AllowPrivilegeEscalation == nil {
+			targetContainer.SecurityContext.AllowPrivilegeEscalation = new(bool)
+		}
+
+		applySecurityProfile(pod, targetContainer, app.Status.SecurityProfile, imageConfig.User)
+		return nil
+	}
+
 	// the image volume
-	pod.Spec.Volumes = append(pod.Spec.Volumes,
-		corev1.Volume{
-			Name: appImageVolume,
-			VolumeSource: corev1.VolumeSource{
-				CSI: &corev1.CSIVolumeSource{
-					Driver: csiImageDriverName,
-					VolumeAttributes: map[string]string{
-						"image": targetImage,
-					},
-				},
-			},
-		})
-	targetContainer.VolumeMounts = append(targetContainer.VolumeMounts,
-		corev1.VolumeMount{
-			Name:      appImageVolume,
-			MountPath: appRoot,
-		})
+	if err = installRootfs(pod, targetContainer, rootfsProvider, targetImage); err != nil {
+		return err
+	}
+
+	// shell resource volumes
+	if shellCtxCM != nil || app.Spec.ShellRC != nil {
+		if err = checkShellContextConflicts(targetContainer, &shellCtx); err != nil {
+			return err
+		}
 
-	// shell resource and history volumes
-	if shellCtxCM != nil {
-		switch sh {
-		case appcorev1.CliAppShellZsh:
-			installShellContext(pod, targetContainer, shellCtxCM, ".zshrc", ".zsh_history")
-		case appcorev1.CliAppShellBash:
-			installShellContext(pod, targetContainer, shellCtxCM, ".bash_profile", ".bash_history")
-		default:
-			panic(sh)
+		if err = r.installShellContext(ctx, pod, targetContainer, app, shellCtxCM, &shellCtx); err != nil {
+			return err
 		}
 	}
 
@@ -285,97 +363,89 @@ func (r *CliAppReconciler) applyAppConfig(
 	return nil
 }
 
-func installShellContext(pod *corev1.Pod, container *corev1.Container, shellCM *corev1.ConfigMap, rc, history string) {
-	if len(shellCM.Data[rc]) > 0 {
-		pod.Spec.Volumes = append(pod.Spec.Volumes,
-			corev1.Volume{
-				Name: "shell-rc",
-				VolumeSource: corev1.VolumeSource{
-					CSI: &corev1.CSIVolumeSource{
-						Driver: csiConfigMapDriverName,
-						VolumeAttributes: map[string]string{
-							"configMap":         "cliapp-shell-context",
-							"namespace":         "cliapp-system",
-							"subPath":           rc,
-							"keepCurrentAlways": "true",
-						},
-					},
-				},
-			})
-		container.VolumeMounts = append(container.VolumeMounts,
-			corev1.VolumeMount{
-				Name:      "shell-rc",
-				MountPath: "/root/" + rc,
-			})
+// parseEnvs converts both Spec.Env and Spec.EnvVars to the container form. Variables in Spec.EnvVars are placed
+// after those in Spec.Env, so they take precedence.
+func parseEnvs(spec *appcorev1.CliAppSpec) ([]corev1.EnvVar, error) {
+	envs := make([]corev1.EnvVar, 0, len(spec.Env)+len(spec.EnvVars))
+	for _, kv := range spec.Env {
+		envPair := strings.SplitN(kv, "=", 2)
+		if len(envPair) != 2 {
+			return nil, xerrors.Errorf(`environment variable must be in the form of "key=value"`)
+		}
+
+		env := corev1.EnvVar{
+			Name:  strings.TrimSpace(envPair[0]),
+			Value: strings.TrimSpace(envPair[1]),
+		}
+
+		if len(env.Name) == 0 {
+			return nil, xerrors.Errorf(`the key of environment variable must be not empty`)
+		}
+
+		envs = append(envs, env)
+	}
+
+	for _, env := range spec.EnvVars {
+		if len(env.Name) == 0 {
+			return nil, xerrors.Errorf(`the name of environment variable must be not empty`)
+		}
+
+		if env.ValueFrom != nil && len(env.Value) > 0 {
+			return nil, xerrors.Errorf(`environment variable %q can't set both value and valueFrom`, env.Name)
+		}
+
+		envs = append(envs, env)
+	}
+
+	for _, from := range spec.EnvFrom {
+		if from.SecretRef == nil && from.ConfigMapRef == nil {
+			return nil, xerrors.Errorf(`specify either a Secret or a ConfigMap in envFrom`)
+		}
+	}
+
+	return envs, nil
+}
+
+// installShellContext mounts the rc file, relative to the home directory, from the key of the shell context
+// ConfigMap named after its base name. The global rc is sourced by the rc of the app if the app has its own.
+// Shell history is kept per user by the session gate.
+func (r *CliAppReconciler) installShellContext(
+	ctx context.Context, pod *corev1.Pod, container *corev1.Container, app *appcorev1.CliApp,
+	shellCM *corev1.ConfigMap, shell *configv1.CliAppShellContext,
+) error {
+	rcPath := filepath.Join(shellHome, shell.RCFile)
+	if app.Spec.ShellRC != nil {
+		rcPath = globalShellRCPath
 	}
 
-	if _, found := shellCM.Data[history]; found {
+	globalRC := false
+	if shellCM != nil && len(shell.RCFile) > 0 && len(shellCM.Data[filepath.Base(shell.RCFile)]) > 0 {
+		globalRC = true
 		pod.Spec.Volumes = append(pod.Spec.Volumes,
 			corev1.Volume{
-				Name: "shell-history",
+				Name: shellRCVolume,
 				VolumeSource: corev1.VolumeSource{
 					CSI: &corev1.CSIVolumeSource{
 						Driver: csiConfigMapDriverName,
 						VolumeAttributes: map[string]string{
-							"configMap":       "cliapp-shell-context",
-							"namespace":       "cliapp-system",
-							"subPath":         history,
-							"commitChangesOn": "unmount",
-							"conflictPolicy":  "override",
-							"oversizePolicy":  "truncateHeadLine",
+							"configMap":         shellContextConfigMap,
+							"namespace":         r.ControllerNamespace,
+							"subPath":           filepath.Base(shell.RCFile),
+							"keepCurrentAlways": "true",
 						},
 					},
 				},
 			})
 		container.VolumeMounts = append(container.VolumeMounts,
 			corev1.VolumeMount{
-				Name:      "shell-history",
-				MountPath: "/root/" + history,
+				Name:      shellRCVolume,
+				MountPath: rcPath,
 			})
 	}
-}
-
-type imageInfo struct {
-	Spec struct {
-		Config struct {
-			Env        []string `json:"Env,omitempty"`
-			WorkingDir string   `json:"WorkingDir,omitempty"`
-		} `json:"config,omitempty"`
-	} `json:"imageSpec,omitempty"`
-}
-
-func (r *CliAppReconciler) fetchImageConfiguration(ctx context.Context, log logr.Logger, image string) (workdir string, paths string, err error) {
-	resp, err := r.CRIImage.ImageStatus(ctx, &cri.ImageStatusRequest{
-		Image:   &cri.ImageSpec{Image: image},
-		Verbose: true,
-	})
-
-	if err != nil {
-		return
-	}
 
-	if len(resp.Info) == 0 {
-		log.Info("no info found for image", "image", image)
-		return
-	}
-
-	if resp.Info["info"] == "" {
-		log.Info("no image info found for image", "image", image)
-		return
-	}
-
-	info := imageInfo{}
-	if err = json.Unmarshal([]byte(resp.Info["info"]), &info); err != nil {
-		log.Error(err, "unable to decode the image spec", "image", image, "spec", resp.Info["info"])
-		return
-	}
-
-	for _, env := range info.Spec.Config.Env {
-		if strings.HasPrefix(env, "PATH=") {
-			paths = env[len("PATH="):]
-			break
-		}
+	if app.Spec.ShellRC == nil {
+		return nil
 	}
 
-	return info.Spec.Config.WorkingDir, paths, nil
+	return r.installAppShellRC(ctx, pod, container, app, shell, globalRC)
 }
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var _ = Describe("CliApp workload", func() {
+	Context("Parse environment variables", func() {
+		It("should keep everything after the first equal sign", func() {
+			envs, err := parseEnvs(&appcorev1.CliAppSpec{
+				Env: []string{"JAVA_OPTS=-Dx=y", "TOKEN=dG9rZW4=", "EMPTY="},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(envs).To(Equal([]corev1.EnvVar{
+				{Name: "JAVA_OPTS", Value: "-Dx=y"},
+				{Name: "TOKEN", Value: "dG9rZW4="},
+				{Name: "EMPTY", Value: ""},
+			}))
+		})
+
+		It("should reject malformed variables", func() {
+			_, err := parseEnvs(&appcorev1.CliAppSpec{Env: []string{"NOVALUE"}})
+			Expect(err).To(HaveOccurred())
+			_, err = parseEnvs(&appcorev1.CliAppSpec{Env: []string{"=value"}})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should put structured variables after the string form", func() {
+			ref := &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "creds"},
+					Key:                  "token",
+				},
+			}
+			envs, err := parseEnvs(&appcorev1.CliAppSpec{
+				Env:     []string{"TOKEN=plain"},
+				EnvVars: []corev1.EnvVar{{Name: "TOKEN", ValueFrom: ref}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(envs).To(HaveLen(2))
+			Expect(envs[1].ValueFrom).To(Equal(ref))
+		})
+	})
+})
+
+var _ = Describe("CliApp volumes", func() {
+	It("should render typed volumes", func() {
+		propagation := corev1.MountPropagationHostToContainer
+		socket := corev1.HostPathSocket
+		volumes, mounts, err := parseVolumes(&appcorev1.CliAppSpec{
+			Volumes: []appcorev1.CliAppVolume{
+				{
+					Name:             "docker",
+					MountPath:        "/var/run/docker.sock",
+					ReadOnly:         true,
+					MountPropagation: &propagation,
+					CliAppVolumeSource: appcorev1.CliAppVolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{Path: "/var/run/docker.sock", Type: &socket},
+					},
+				},
+				{
+					Name:      "cache",
+					MountPath: "/root/go/",
+					CliAppVolumeSource: appcorev1.CliAppVolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "go-cache"},
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(volumes).To(HaveLen(2))
+		Expect(volumes[0].HostPath.Type).To(Equal(&socket))
+		Expect(volumes[1].PersistentVolumeClaim.ClaimName).To(Equal("go-cache"))
+		Expect(mounts[0].ReadOnly).To(BeTrue())
+		Expect(mounts[0].MountPropagation).To(Equal(&propagation))
+		Expect(mounts[1].MountPath).To(Equal("/root/go"))
+	})
+
+	It("should reject collisions", func() {
+		emptyDir := appcorev1.CliAppVolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+		for _, spec := range []appcorev1.CliAppSpec{
+			{Volumes: []appcorev1.CliAppVolume{{Name: appImageVolume, MountPath: "/data", CliAppVolumeSource: emptyDir}}},
+			{Volumes: []appcorev1.CliAppVolume{{Name: "data", MountPath: appRoot, CliAppVolumeSource: emptyDir}}},
+			{Volumes: []appcorev1.CliAppVolume{{Name: "data", MountPath: appRoot + "/etc", CliAppVolumeSource: emptyDir}}},
+			{Volumes: []appcorev1.CliAppVolume{{Name: "data", MountPath: "/root/.zshrc", CliAppVolumeSource: emptyDir}}},
+			{Volumes: []appcorev1.CliAppVolume{{Name: "data", MountPath: "/data"}}},
+			{
+				HostPath: []string{"/data"},
+				Volumes:  []appcorev1.CliAppVolume{{Name: "data", MountPath: "/data", CliAppVolumeSource: emptyDir}},
+			},
+			{
+				Volumes: []appcorev1.CliAppVolume{
+					{Name: "data", MountPath: "/data", CliAppVolumeSource: emptyDir},
+					{Name: "data", MountPath: "/tmp", CliAppVolumeSource: emptyDir},
+				},
+			},
+		} {
+			_, _, err := parseVolumes(&spec)
+			Expect(err).To(HaveOccurred())
+		}
+	})
+})
+
+var _ = Describe("CliApp pod template", func() {
+	app := &appcorev1.CliApp{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "uid"},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "app-xxxxx",
+			Namespace:       "default",
+			Labels:          map[string]string{appLabel: "app"},
+			OwnerReferences: []metav1.OwnerReference{{Name: "app", UID: "uid", Controller: &enabled}},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:         appContainer,
+				Image:        "busybox",
+				VolumeMounts: []corev1.VolumeMount{{Name: appImageVolume, MountPath: appRoot}},
+			}},
+			Volumes: []corev1.Volume{{Name: appImageVolume}},
+		},
+	}
+
+	It("should merge the patch into the Pod", func() {
+		app.Spec.PodTemplate = &runtime.RawExtension{
+			Raw: []byte(`{"metadata":{"labels":{"team":"infra"}},"spec":{"nodeSelector":{"disk":"ssd"},` +
+				`"priorityClassName":"low","tolerations":[{"key":"dedicated","operator":"Exists"}]}}`),
+		}
+		patched, err := applyPodTemplate(pod.DeepCopy(), app)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(patched.Labels).To(HaveKeyWithValue("team", "infra"))
+		Expect(patched.Labels).To(HaveKeyWithValue(appLabel, "app"))
+		Expect(patched.Spec.NodeSelector).To(HaveKeyWithValue("disk", "ssd"))
+		Expect(patched.Spec.PriorityClassName).To(Equal("low"))
+		Expect(patched.Spec.Tolerations).To(HaveLen(1))
+		Expect(patched.Spec.Containers).To(HaveLen(1))
+	})
+
+	It("should refuse to remove what the app depends on", func() {
+		for _, patch := range []string{
+			`{"spec":{"containers":[{"name":"workspace","$patch":"delete"}]}}`,
+			`{"spec":{"volumes":[{"name":"app","$patch":"delete"}]}}`,
+			`{"metadata":{"ownerReferences":null}}`,
+			`{"spec":{"containers":[{"name":"workspace","image":"alpine"}]}}`,
+			`{"spec":{"containers":[{"name":"workspace","volumeMounts":[{"mountPath":"/app-root","$patch":"delete"}]}]}}`,
+			`{"spec":{"containers":[{"name":"workspace","volumeMounts":[{"mountPath":"/app-root","name":"data"}]}]}}`,
+		} {
+			app.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(patch)}
+			_, err := applyPodTemplate(pod.DeepCopy(), app)
+			Expect(err).To(HaveOccurred())
+			Expect(validatePodTemplate(&app.Spec)).NotTo(Succeed())
+		}
+	})
+
+	It("should expose the service account of the template to resolve pull credentials", func() {
+		app := &appcorev1.CliApp{Spec: appcorev1.CliAppSpec{PodTemplate: &runtime.RawExtension{
+			Raw: []byte(`{"spec":{"serviceAccountName":"puller","imagePullSecrets":[{"name":"registry"}]}}`),
+		}}}
+		pod := &corev1.Pod{Spec: corev1.PodSpec{ImagePullSecrets: []corev1.LocalObjectReference{{Name: "app"}}}}
+		merged, err := mergePodTemplate(pod, app)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged.Spec.ServiceAccountName).To(Equal("puller"))
+		Expect(merged.Spec.ImagePullSecrets).To(ConsistOf(
+			corev1.LocalObjectReference{Name: "app"}, corev1.LocalObjectReference{Name: "registry"},
+		))
+		Expect(pod.Spec.ServiceAccountName).To(BeEmpty())
+	})
+
+	It("should validate templates against a skeleton Pod", func() {
+		spec := &appcorev1.CliAppSpec{Image: "busybox", PodTemplate: &runtime.RawExtension{
+			Raw: []byte(`{"spec":{"nodeSelector":{"disk":"ssd"}}}`),
+		}}
+		Expect(validatePodTemplate(spec)).To(Succeed())
+
+		spec.PodTemplate.Raw = []byte(`{"spec":{"nodeSelector":"ssd"}}`)
+		Expect(validatePodTemplate(spec)).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("CliApp resources", func() {
+	defaults := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("10m"),
+			corev1.ResourceMemory: resource.MustParse("32Mi"),
+		},
+	}
+	max := corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}
+
+	It("should override defaults per resource", func() {
+		merged := mergeResources(defaults, corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+		})
+		Expect(merged.Requests.Cpu().String()).To(Equal("10m"))
+		Expect(merged.Requests.Memory().String()).To(Equal("256Mi"))
+		Expect(merged.Limits.Memory().String()).To(Equal("512Mi"))
+		Expect(validateResources(&merged, max)).To(Succeed())
+	})
+
+	It("should reject resources over the maximum", func() {
+		merged := mergeResources(defaults, corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+		})
+		Expect(validateResources(&merged, max)).NotTo(Succeed())
+	})
+})
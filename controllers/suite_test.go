@@ -104,7 +104,11 @@ var _ = BeforeSuite(func() {
 		Client:                k8sClient,
 		Log:                   ctrl.Log.WithName("controllers").WithName("CliApp"),
 		Scheme:                k8sManager.GetScheme(),
+		Recorder:              k8sManager.GetEventRecorderFor("cliapp-controller"),
 		DurationIdleLiveLasts: 5 * time.Minute,
+		MaxRetries:            DefaultMaxRetries,
+		RetryBackoff:          DefaultRetryBackoff,
+		RolloutGracePeriod:    DefaultRolloutGrace,
 		BuilderEndpoint:       "",
 		ControllerNamespace:   controllerNS,
 	}).SetupWithManager(k8sManager)
@@ -3,6 +3,7 @@ module github.com/warm-metal/cliapp
 go 1.15
 
 require (
+	github.com/containerd/containerd v1.4.4
 	github.com/davecgh/go-spew v1.1.1
 	github.com/fatih/color v1.10.0
 	github.com/go-logr/logr v0.4.0
@@ -11,6 +12,9 @@ require (
 	github.com/moby/term v0.0.0-20201216013528-df9cb8a40635
 	github.com/onsi/ginkgo v1.16.4
 	github.com/onsi/gomega v1.13.0
+	github.com/opencontainers/go-digest v1.0.0
+	github.com/opencontainers/image-spec v1.0.1
+	github.com/robfig/cron/v3 v3.0.1
 	go.uber.org/atomic v1.7.0
 	golang.org/x/sys v0.0.0-20210603081109-ebe580a85c40
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
@@ -17,7 +17,9 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -32,44 +34,167 @@ type CliAppSpec struct {
 	Fork *ForkObject `json:"fork,omitempty"`
 
 	// Specify the image the app uses.
-	// Only one of Image or Dockerfile can be set.
+	// Only one of Image, Dockerfile or Packages can be set. The controller sets it to the image it builds from
+	// Dockerfile or Packages.
 	// +optional
 	Image string `json:"image,omitempty"`
 
+	// Secrets to pull the app image, in addition to pull secrets of the service account.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
 	// Specify a Dockerfile to build a image used to run the app. Http(s) URI is also supported.
-	// Only one of Image or Dockerfile can be set.
+	// Only one of Image, Dockerfile or Packages can be set.
 	// +optional
 	Dockerfile string `json:"dockerfile,omitempty"`
 
+	// Packages installed by the package manager of Distro, such as apk for alpine and apt for ubuntu, to build
+	// the image used to run the app. Versions could be pinned in the form of "name=version".
+	// The image is rebuilt once packages or Distro change.
+	// Only one of Image, Dockerfile or Packages can be set.
+	// +optional
+	Packages []string `json:"packages,omitempty"`
+
 	// Set the command to be executed when client runs the app.
 	// It is usually an executable binary. It should be found in the PATH, or an absolute path to the binary.
 	// If no set, session-gate will run commands in the app context rootfs instead of the rootfs of Spec.Image.
+	// The app fails with reason CommandNotFound if the command is not an executable in the image.
 	// +optional
 	Command []string `json:"command,omitempty"`
 
+	// Named commands which share the app Pod. Keys are aliases the client specifies to open sessions,
+	// and values are commands in the same form as Command. Clients could install a shortcut per alias.
+	// The app fails with reason CommandNotFound if any of them is not an executable in the image.
+	// +optional
+	Commands map[string][]string `json:"commands,omitempty"`
+
+	// Set if the image entrypoint and cmd are used as the command while Command is not set.
+	// Arguments from the client replace the image cmd as "docker run" does.
+	// +optional
+	UseImageEntrypoint bool `json:"useImageEntrypoint,omitempty"`
+
+	// How the app runs.
+	// +optional
+	// Valid values are:
+	// - "Chroot" (default): The app runs in the context image with SYS_ADMIN, and commands run in the app image
+	//   via chroot;
+	// - "Native": The app image runs as the workspace container without extra privileges, and commands run
+	//   directly in it. The shell context, Distro, Shell and RootfsProvider don't take effect.
+	ExecutionMode CliAppExecutionMode `json:"executionMode,omitempty"`
+
+	// The Pod Security Standards profile the app Pod complies with. The default is set by the controller.
+	// +optional
+	// Valid values are:
+	// - "Privileged": The app Pod works without restrictions;
+	// - "Baseline": The app Pod complies with the baseline profile. Only the Native execution mode is supported,
+	//   and hostPath volumes are disallowed;
+	// - "Restricted": The app Pod complies with the restricted profile. The app runs as non-root with seccomp
+	//   RuntimeDefault and all capabilities dropped besides the restrictions of Baseline.
+	//   The app runs as 65534 if its image runs as root or a user name. Every container, including those of
+	//   the forked workload and Spec.PodTemplate, must comply. PrePull can't use the InitContainer rootfs provider.
+	SecurityProfile CliAppSecurityProfile `json:"securityProfile,omitempty"`
+
+	// How the app image is mounted as the root filesystem of the app. The default is set by the controller.
+	// +optional
+	// Valid values are:
+	// - "CSIImage": The image is mounted via the CSI driver csi-image.warm-metal.tech;
+	// - "ImageVolume": The image is mounted via the Kubernetes native image volume, which is read-only;
+	// - "InitContainer": An init container copies the image into an emptyDir. The app image must provide sh and cp.
+	RootfsProvider CliAppRootfsProvider `json:"rootfsProvider,omitempty"`
+
+	// Images mounted along with the app image, each at "/app-tools/<name>" of both the app context and
+	// the app rootfs. Directories in PATH of their configuration are appended to PATH of the app in order,
+	// after those of the app image, unless the app overrides PATH. Commands still run in the app rootfs,
+	// so tools must be statically linked binaries, since neither the dynamic loader nor the interpreter of
+	// scripts in tool images is available outside their roots. Not supported in the Native execution mode,
+	// or with the ImageVolume rootfs provider, whose rootfs is read-only.
+	// +optional
+	ToolImages []CliAppToolImage `json:"toolImages,omitempty"`
+
 	// Host paths would be mounted to the app.
 	// Each HostPath can be an absolute host path, or in the form of "hostpath:mount-point".
 	// +optional
 	HostPath []string `json:"hostpath,omitempty"`
 
+	// Volumes would be mounted to the app along with the app image.
+	// +optional
+	Volumes []CliAppVolume `json:"volumes,omitempty"`
+
 	// Environment variables in the form of "key=value".
+	// Only the first "=" separates the key from the value, so values can also contain "=".
 	// +optional
 	Env []string `json:"env,omitempty"`
 
+	// Environment variables in the structured form. Each value can be either a literal,
+	// or referred from a Secret, a ConfigMap, or a field of the Pod.
+	// Variables defined here take precedence over those in Env.
+	// +optional
+	EnvVars []corev1.EnvVar `json:"envVars,omitempty"`
+
+	// Secrets or ConfigMaps whose keys would be all populated as environment variables.
+	// Variables defined in Env or EnvVars take precedence over those in EnvFrom.
+	// +optional
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+
 	// Distro the app dependents. The default is alpine.
 	// +optional
-	// Valid values are:
+	// Valid values are distros the controller configures. Built-in ones are:
 	// - "alpine" (default): The app works on Alpine;
-	// - "ubuntu: The app works on Ubuntu.
+	// - "ubuntu": The app works on Ubuntu;
+	// - "debian": The app works on Debian;
+	// - "fedora": The app works on Fedora;
+	// - "arch": The app works on Arch Linux.
 	Distro CliAppDistro `json:"distro,omitempty"`
 
-	// The shell interpreter you preferred. Can be either bash or zsh.
+	// The shell interpreter you preferred.
 	// +optional
-	// Valid values are:
+	// Valid values are shells the controller configures. Built-in ones are:
 	// - "bash" (default): The app will run in Bash;
-	// - "zsh: The app will run in Zsh.
+	// - "zsh": The app will run in Zsh;
+	// - "fish": The app will run in Fish;
+	// - "sh": The app will run in the POSIX shell of the context image.
 	Shell CliAppShell `json:"shell,omitempty"`
 
+	// Shell configuration of the app, such as aliases, functions, completion or the prompt.
+	// It is sourced after the global rc of Shell. Variables CLIAPP_NAME and CLIAPP_NAMESPACE are set in the
+	// app context to customize the prompt.
+	// +optional
+	ShellRC *CliAppShellRC `json:"shellRC,omitempty"`
+
+	// Shell history of the app. The history is kept per authenticated user in the Secret cliapp-shell-history
+	// of the app namespace, and restored in later shell sessions of the same user. Shells without a history
+	// variable in the controller registry, such as the built-in fish, keep no history.
+	// While a session is open, its history is a file in a tmpfs of its own mount namespace, which other sessions
+	// don't see. It requires unshare, mount and umount in the app context; history is not kept without them.
+	// Sessions still run as the same user in the workspace container, so users who inspect processes of
+	// other sessions could read their history. Disable it if that is not acceptable.
+	// +optional
+	ShellHistory *CliAppShellHistory `json:"shellHistory,omitempty"`
+
+	// Set to mount a persistent home for each authenticated user of the app, if the controller provisions
+	// user homes. The homes are SHARED storage rather than private homes: homes of all users are mounted in
+	// the workspace container which sessions share, so every user can read and write homes of the others.
+	// Only set it for apps of a single user or users who trust each other.
+	// Homes are mounted when Pods are created, so new users use the app home until the app restarts, which
+	// the condition UserHomesMounted reports.
+	// In the Chroot mode, homes are also mounted in the app rootfs, which the ImageVolume provider can't do.
+	// +optional
+	SharedUserHomes bool `json:"sharedUserHomes,omitempty"`
+
+	// Compute resources of the workspace container.
+	// Unset requests or limits are taken from the default resources of the controller,
+	// and all values can't exceed the maximum resources of the controller.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// A strategic merge patch applied to the Pod generated for the app, either a plain or a forked one.
+	// It is in the form of a partial Pod manifest, such as
+	// {"metadata": {"labels": {...}}, "spec": {"nodeSelector": {...}, "tolerations": [...]}}.
+	// The patch can't remove the workspace container, the app image volume, or the owner reference of the Pod.
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	PodTemplate *runtime.RawExtension `json:"podTemplate,omitempty"`
+
 	// The target phase the app should achieve.
 	// Valid values are:
 	// - "Rest" (default): The app is installed but not started;
@@ -79,6 +204,160 @@ type CliAppSpec struct {
 	// Set if uninstalls the App when it transits out of phase Live
 	// +optional
 	UninstallUnlessLive bool `json:"uninstall,omitempty"`
+
+	// Specify how the app Pod is replaced once the spec changes.
+	// +optional
+	Rollout *CliAppRollout `json:"rollout,omitempty"`
+
+	// Specify when the app keeps alive without sessions.
+	// +optional
+	KeepAlive *CliAppKeepAlive `json:"keepAlive,omitempty"`
+
+	// Specify how image tags are pinned to digests.
+	// +optional
+	ImagePolicy *CliAppImagePolicy `json:"imagePolicy,omitempty"`
+
+	// Set if the context image, the app image and tool images are pulled on nodes once the app is installed or
+	// its images change, so that the first session doesn't wait for pulling. Nodes are selected by the nodeSelector
+	// in PodTemplate if set. Apps forking other workloads are not supported.
+	// +optional
+	PrePull bool `json:"prePull,omitempty"`
+}
+
+type CliAppToolImage struct {
+	// Name of the image, which must be a DNS label. The image is mounted at "/app-tools/<name>".
+	Name string `json:"name"`
+
+	// The image reference.
+	Image string `json:"image"`
+}
+
+type CliAppToolImageStatus struct {
+	// Name of the image.
+	Name string `json:"name"`
+
+	// The image the app actually uses.
+	Image string `json:"image"`
+
+	// Digest of the image.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+
+	// PATH of the image configuration.
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+type CliAppPackagesStatus struct {
+	// The distro packages are installed on.
+	Distro CliAppDistro `json:"distro"`
+
+	// Sorted packages the image is built with.
+	Requested []string `json:"requested"`
+
+	// Resolved versions of installed packages.
+	// +optional
+	Installed []CliAppPackage `json:"installed,omitempty"`
+}
+
+type CliAppPackage struct {
+	// Name of the package.
+	Name string `json:"name"`
+
+	// Version the package manager installed.
+	Version string `json:"version"`
+}
+
+type CliAppShellRC struct {
+	// Content of the rc in the syntax of the app shell.
+	// +optional
+	Inline string `json:"inline,omitempty"`
+
+	// A key of the ConfigMap in the app namespace, which is sourced after Inline.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+}
+
+type CliAppShellHistory struct {
+	// Set to keep no shell history of the app.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// The maximum number of lines kept for each user. The default is 1000.
+	// The history of each user is also capped to 64KiB.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxLines int32 `json:"maxLines,omitempty"`
+}
+
+type CliAppKeepAlive struct {
+	// Policy to keep the app alive.
+	// Valid values are:
+	// - "OnDemand" (default): The app goes Live once a session opens, and shuts down after being idle for IdleTimeout;
+	// - "AlwaysOn": The app is always Live no matter whether sessions open;
+	// - "Scheduled": The app goes Live in any of the WarmWindows, and works like OnDemand out of them.
+	// +optional
+	Policy CliAppKeepAlivePolicy `json:"policy,omitempty"`
+
+	// The duration the app lasts after all its sessions closed. 0 means shutting down immediately.
+	// The default value is set by the controller.
+	// +optional
+	IdleTimeout *metav1.Duration `json:"idleTimeout,omitempty"`
+
+	// Windows in which the app is kept Live in the Scheduled policy.
+	// +optional
+	WarmWindows []CliAppWarmWindow `json:"warmWindows,omitempty"`
+}
+
+// CliAppKeepAlivePolicy describes when the app keeps alive.
+// +kubebuilder:validation:Enum=OnDemand;AlwaysOn;Scheduled
+type CliAppKeepAlivePolicy string
+
+const (
+	CliAppKeepAliveOnDemand  CliAppKeepAlivePolicy = "OnDemand"
+	CliAppKeepAliveAlwaysOn  CliAppKeepAlivePolicy = "AlwaysOn"
+	CliAppKeepAliveScheduled CliAppKeepAlivePolicy = "Scheduled"
+)
+
+type CliAppWarmWindow struct {
+	// A cron expression in the standard 5-field form when the window opens, such as "0 9 * * 1-5".
+	// The time zone can be set via the prefix "CRON_TZ=", such as "CRON_TZ=Asia/Shanghai 0 9 * * 1-5".
+	// The default time zone is the one of the controller.
+	Schedule string `json:"schedule"`
+
+	// How long the window lasts.
+	Duration metav1.Duration `json:"duration"`
+}
+
+type CliAppRollout struct {
+	// Strategy to replace outdated Pods.
+	// Valid values are:
+	// - "Graceful" (default): A new Pod is started for new sessions, while outdated Pods are deleted
+	// after all their sessions are closed or the grace period passes;
+	// - "Recreate": Outdated Pods are deleted immediately, along with all their sessions.
+	// +optional
+	Strategy CliAppRolloutStrategy `json:"strategy,omitempty"`
+
+	// The longest duration an outdated Pod could live for its sessions in the Graceful strategy.
+	// The default value is set by the controller.
+	// +optional
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+}
+
+// CliAppRolloutStrategy describes how to replace outdated Pods.
+// +kubebuilder:validation:Enum=Graceful;Recreate
+type CliAppRolloutStrategy string
+
+const (
+	CliAppRolloutGraceful CliAppRolloutStrategy = "Graceful"
+	CliAppRolloutRecreate CliAppRolloutStrategy = "Recreate"
+)
+
+type CliAppImagePolicy struct {
+	// Interval to resolve image tags again. The app Pod is rolled out according to Spec.Rollout
+	// once a digest changes. If not set, tags are only resolved when images change.
+	// +optional
+	RefreshInterval *metav1.Duration `json:"refreshInterval,omitempty"`
 }
 
 type ForkObject struct {
@@ -97,22 +376,105 @@ type ForkObject struct {
 	WithEnvs bool `json:"withEnvs,omitempty"`
 }
 
-// CliAppDistro describes Linux Distro the app depends.
-// +kubebuilder:validation:Enum=alpine;ubuntu
+// CliAppVolume describes a volume and where it is mounted in the app.
+type CliAppVolume struct {
+	// Name of the volume. It must be unique in the app.
+	Name string `json:"name"`
+
+	// Absolute path in the app at which the volume should be mounted.
+	// It can't be the app root "/app-root" or any path of the shell context.
+	MountPath string `json:"mountPath"`
+
+	// Path within the volume from which the app's volume should be mounted.
+	// +optional
+	SubPath string `json:"subPath,omitempty"`
+
+	// Mounted read-only if true.
+	// +optional
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// Determines how mounts are propagated from the host to container and the other way around.
+	// +optional
+	MountPropagation *corev1.MountPropagationMode `json:"mountPropagation,omitempty"`
+
+	// The volume source. Only one of HostPath, PersistentVolumeClaim, Secret, ConfigMap and EmptyDir can be set.
+	CliAppVolumeSource `json:",inline"`
+}
+
+// CliAppVolumeSource represents the source of a volume to mount.
+type CliAppVolumeSource struct {
+	// A file or directory on the host.
+	// +optional
+	HostPath *corev1.HostPathVolumeSource `json:"hostPath,omitempty"`
+
+	// A PersistentVolumeClaim in the same namespace of the app.
+	// +optional
+	PersistentVolumeClaim *corev1.PersistentVolumeClaimVolumeSource `json:"persistentVolumeClaim,omitempty"`
+
+	// A Secret in the same namespace of the app.
+	// +optional
+	Secret *corev1.SecretVolumeSource `json:"secret,omitempty"`
+
+	// A ConfigMap in the same namespace of the app.
+	// +optional
+	ConfigMap *corev1.ConfigMapVolumeSource `json:"configMap,omitempty"`
+
+	// A temporary directory that shares the app's lifetime.
+	// +optional
+	EmptyDir *corev1.EmptyDirVolumeSource `json:"emptyDir,omitempty"`
+}
+
+// CliAppDistro describes Linux Distro the app depends. Valid values are distros the controller configures.
 type CliAppDistro string
 
+// Built-in distros.
 const (
 	CliAppDistroAlpine CliAppDistro = "alpine"
 	CliAppDistroUbuntu CliAppDistro = "ubuntu"
+	CliAppDistroDebian CliAppDistro = "debian"
+	CliAppDistroFedora CliAppDistro = "fedora"
+	CliAppDistroArch   CliAppDistro = "arch"
+)
+
+// CliAppExecutionMode describes how the app runs.
+// +kubebuilder:validation:Enum=Chroot;Native
+type CliAppExecutionMode string
+
+const (
+	CliAppExecutionModeChroot CliAppExecutionMode = "Chroot"
+	CliAppExecutionModeNative CliAppExecutionMode = "Native"
+)
+
+// CliAppSecurityProfile describes the Pod Security Standards profile the app complies with.
+// +kubebuilder:validation:Enum=Privileged;Baseline;Restricted
+type CliAppSecurityProfile string
+
+const (
+	CliAppSecurityProfilePrivileged CliAppSecurityProfile = "Privileged"
+	CliAppSecurityProfileBaseline   CliAppSecurityProfile = "Baseline"
+	CliAppSecurityProfileRestricted CliAppSecurityProfile = "Restricted"
+)
+
+// CliAppRootfsProvider describes how the app image is mounted.
+// +kubebuilder:validation:Enum=CSIImage;ImageVolume;InitContainer
+type CliAppRootfsProvider string
+
+const (
+	CliAppRootfsProviderCSIImage      CliAppRootfsProvider = "CSIImage"
+	CliAppRootfsProviderImageVolume   CliAppRootfsProvider = "ImageVolume"
+	CliAppRootfsProviderInitContainer CliAppRootfsProvider = "InitContainer"
 )
 
-// CliAppShell describes the shell interpreter the app prefers to use.
-// +kubebuilder:validation:Enum=bash;zsh
+// CliAppShell describes the shell interpreter the app prefers to use. Valid values are shells the controller
+// configures.
 type CliAppShell string
 
+// Built-in shells.
 const (
 	CliAppShellBash CliAppShell = "bash"
 	CliAppShellZsh  CliAppShell = "zsh"
+	CliAppShellFish CliAppShell = "fish"
+	CliAppShellSh   CliAppShell = "sh"
 )
 
 // CliAppStatus defines the observed state of CliApp
@@ -127,7 +489,8 @@ type CliAppStatus struct {
 	// - "Building": The app is waiting for image building;
 	// - "Live": The app is running;
 	// - "WaitingForSessions": The app is waiting for new sessions and will be shutdown later;
-	// - "ShuttingDown": The app is shutting down.
+	// - "ShuttingDown": The app is shutting down;
+	// - "Failed": The app failed to start after retries.
 	// +optional
 	Phase CliAppPhase `json:"phase,omitempty"`
 
@@ -139,13 +502,229 @@ type CliAppStatus struct {
 	// +optional
 	PodName string `json:"podName,omitempty"`
 
+	// Outdated Pods which are still serving sessions opened before the spec changed.
+	// +optional
+	RetiringPods []string `json:"retiringPods,omitempty"`
+
+	// Progress of pulling images on nodes if Spec.PrePull is set.
+	// +optional
+	PrePull *CliAppPrePullStatus `json:"prePull,omitempty"`
+
 	// Specify Errors on reconcile.
 	// +optional
 	Error string `json:"error,omitempty"`
+
+	// The latest failure while starting the app.
+	// The app transits to phase Failed once the number of retries exceeds the limit.
+	// Set annotation "cliapp.warm-metal.tech/retry" to retry a failed app.
+	// +optional
+	Failure *CliAppFailure `json:"failure,omitempty"`
+
+	// The generation of the app spec that the status reflects.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Latest observations of the app state.
+	// Known condition types are "ImageReady", "PodScheduled", "Ready", "Degraded", "ImagePrePulled"
+	// and "SecurityProfileSatisfied".
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// The Linux distro the app actually uses.
+	// +optional
+	Distro CliAppDistro `json:"distro,omitempty"`
+
+	// The shell interpreter the app actually uses.
+	// +optional
+	Shell CliAppShell `json:"shell,omitempty"`
+
+	// The login command of the shell, which debug sessions run if the client specifies no command.
+	// +optional
+	ShellCommand []string `json:"shellCommand,omitempty"`
+
+	// The environment variable the shell reads the history file from. Shell history is not kept if empty.
+	// +optional
+	ShellHistoryEnv string `json:"shellHistoryEnv,omitempty"`
+
+	// The directory homes of session users are mounted in, each at the subdirectory named after the user key.
+	// Sessions running in the app context use their own homes. Empty if the controller keeps no user homes.
+	// +optional
+	UserHomeDir string `json:"userHomeDir,omitempty"`
+
+	// The context image the app actually uses.
+	// +optional
+	ContextImage string `json:"contextImage,omitempty"`
+
+	// The app image the app actually uses.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// The security profile the app actually uses.
+	// +optional
+	SecurityProfile CliAppSecurityProfile `json:"securityProfile,omitempty"`
+
+	// The rootfs provider the app actually uses.
+	// +optional
+	RootfsProvider CliAppRootfsProvider `json:"rootfsProvider,omitempty"`
+
+	// Digest of the app image.
+	// +optional
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// Tool images the app actually uses.
+	// +optional
+	ToolImages []CliAppToolImageStatus `json:"toolImages,omitempty"`
+
+	// Packages the app image is built with.
+	// +optional
+	Packages *CliAppPackagesStatus `json:"packages,omitempty"`
+
+	// Configuration of the app image.
+	// +optional
+	ImageConfig *CliAppImageConfig `json:"imageConfig,omitempty"`
+
+	// Digests of images the app Pod uses.
+	// +optional
+	PinnedImages *CliAppPinnedImages `json:"pinnedImages,omitempty"`
+}
+
+// CliAppPinnedImages records digests of images which Pods are rendered with.
+type CliAppPinnedImages struct {
+	// The app image and its digest in the form of "name@digest".
+	// +optional
+	Image string `json:"image,omitempty"`
+	// +optional
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// The context image and its digest in the form of "name@digest".
+	ContextImage string `json:"contextImage"`
+	// +optional
+	ContextImageDigest string `json:"contextImageDigest,omitempty"`
+
+	// Tool images and their digests, in the order of Spec.ToolImages.
+	// +optional
+	ToolImages []CliAppPinnedToolImage `json:"toolImages,omitempty"`
+
+	// The last time images are resolved.
+	ResolvedAt metav1.Time `json:"resolvedAt"`
+}
+
+// CliAppPinnedToolImage is a tool image and its digest in the form of "name@digest".
+type CliAppPinnedToolImage struct {
+	Image string `json:"image"`
+	// +optional
+	Digest string `json:"digest,omitempty"`
 }
 
+// CliAppImageConfig is the configuration of the app image that commands run with.
+type CliAppImageConfig struct {
+	// Environment variables of the image in the form of "key=value".
+	// +optional
+	Env []string `json:"env,omitempty"`
+
+	// The user commands run as. It is empty if the chroot of the app context image doesn't support "--userspec",
+	// in which case commands run as root.
+	// +optional
+	User string `json:"user,omitempty"`
+
+	// +optional
+	Entrypoint []string `json:"entrypoint,omitempty"`
+
+	// +optional
+	Cmd []string `json:"cmd,omitempty"`
+
+	// +optional
+	WorkingDir string `json:"workingDir,omitempty"`
+}
+
+// CliAppPrePullStatus describes progress of pulling images on nodes.
+type CliAppPrePullStatus struct {
+	// Images being pulled.
+	Images []string `json:"images,omitempty"`
+
+	// Progress on each node.
+	// +optional
+	// +listType=map
+	// +listMapKey=node
+	Nodes []CliAppNodePrePull `json:"nodes,omitempty"`
+}
+
+type CliAppNodePrePull struct {
+	Node string `json:"node"`
+
+	Phase CliAppPrePullPhase `json:"phase"`
+
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Number of failed pulls on the node. Failed pulls are retried with backoff until images are pulled.
+	// +optional
+	Retries int32 `json:"retries,omitempty"`
+
+	// The time of the last failed pull.
+	// +optional
+	FailedAt *metav1.Time `json:"failedAt,omitempty"`
+}
+
+// CliAppPrePullPhase describes whether images are pulled on a node.
+// +kubebuilder:validation:Enum=Pulling;Pulled;Failed
+type CliAppPrePullPhase string
+
+const (
+	CliAppPrePullPulling CliAppPrePullPhase = "Pulling"
+	CliAppPrePullPulled  CliAppPrePullPhase = "Pulled"
+	CliAppPrePullFailed  CliAppPrePullPhase = "Failed"
+)
+
+// CliAppFailure describes the latest failure while starting the app.
+type CliAppFailure struct {
+	// A brief CamelCase reason of the failure, such as CrashLoopBackOff, ErrImagePull, or Unschedulable.
+	Reason string `json:"reason"`
+
+	// Details of the failure.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Number of retries have been taken.
+	Retries int32 `json:"retries"`
+
+	// Timestamp of the latest failure.
+	Time metav1.Time `json:"time"`
+
+	// Hash of the app spec which failed. The failure is cleared once the spec changes.
+	SpecHash string `json:"specHash"`
+}
+
+const (
+	// CliAppConditionImageReady is true if the app image is specified or built.
+	CliAppConditionImageReady = "ImageReady"
+
+	// CliAppConditionPodScheduled is true if the app Pod is scheduled to a node.
+	CliAppConditionPodScheduled = "PodScheduled"
+
+	// CliAppConditionReady is true if the app Pod is ready to open sessions.
+	CliAppConditionReady = "Ready"
+
+	// CliAppConditionDegraded is true if the last reconcile failed.
+	CliAppConditionDegraded = "Degraded"
+
+	// CliAppConditionImagePrePulled is true if images are pulled on all nodes if Spec.PrePull is set.
+	CliAppConditionImagePrePulled = "ImagePrePulled"
+
+	// CliAppConditionSecurityProfileSatisfied is true if the app works under its security profile.
+	CliAppConditionSecurityProfileSatisfied = "SecurityProfileSatisfied"
+
+	// CliAppConditionUserHomesMounted is true if homes of all users are mounted in the app Pod,
+	// if Spec.SharedUserHomes is set. Homes of new users are mounted once the app restarts.
+	CliAppConditionUserHomesMounted = "UserHomesMounted"
+)
+
 // CliAppPhase describes the app status.
-// +kubebuilder:validation:Enum=Rest;Recovering;Building;Live;WaitingForSessions;ShuttingDown
+// +kubebuilder:validation:Enum=Rest;Recovering;Building;Live;WaitingForSessions;ShuttingDown;Failed
 type CliAppPhase string
 
 const (
@@ -155,6 +734,7 @@ const (
 	CliAppPhaseLive               CliAppPhase = "Live"
 	CliAppPhaseWaitingForSessions CliAppPhase = "WaitingForSessions"
 	CliAppPhaseShuttingDown       CliAppPhase = "ShuttingDown"
+	CliAppPhaseFailed             CliAppPhase = "Failed"
 )
 
 //+genclient
@@ -163,6 +743,7 @@ const (
 //+kubebuilder:printcolumn:name="TargetPhase",type=string,JSONPath=`.spec.targetPhase`
 //+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
 //+kubebuilder:printcolumn:name="Pod",type=string,JSONPath=`.status.podName`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
 //+kubebuilder:printcolumn:name="Error",type=string,JSONPath=`.status.error`
 //+kubebuilder:printcolumn:name="Distro",type=string,JSONPath=`.spec.distro`
 //+kubebuilder:printcolumn:name="Shell",type=string,JSONPath=`.spec.shell`
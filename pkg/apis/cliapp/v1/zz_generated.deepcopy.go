@@ -21,6 +21,8 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -51,6 +53,97 @@ func (in *CliApp) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppFailure) DeepCopyInto(out *CliAppFailure) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppFailure.
+func (in *CliAppFailure) DeepCopy() *CliAppFailure {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppFailure)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppImageConfig) DeepCopyInto(out *CliAppImageConfig) {
+	*out = *in
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Entrypoint != nil {
+		in, out := &in.Entrypoint, &out.Entrypoint
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Cmd != nil {
+		in, out := &in.Cmd, &out.Cmd
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppImageConfig.
+func (in *CliAppImageConfig) DeepCopy() *CliAppImageConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppImageConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppImagePolicy) DeepCopyInto(out *CliAppImagePolicy) {
+	*out = *in
+	if in.RefreshInterval != nil {
+		in, out := &in.RefreshInterval, &out.RefreshInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppImagePolicy.
+func (in *CliAppImagePolicy) DeepCopy() *CliAppImagePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppImagePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppKeepAlive) DeepCopyInto(out *CliAppKeepAlive) {
+	*out = *in
+	if in.IdleTimeout != nil {
+		in, out := &in.IdleTimeout, &out.IdleTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.WarmWindows != nil {
+		in, out := &in.WarmWindows, &out.WarmWindows
+		*out = make([]CliAppWarmWindow, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppKeepAlive.
+func (in *CliAppKeepAlive) DeepCopy() *CliAppKeepAlive {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppKeepAlive)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CliAppList) DeepCopyInto(out *CliAppList) {
 	*out = *in
@@ -83,6 +176,183 @@ func (in *CliAppList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppNodePrePull) DeepCopyInto(out *CliAppNodePrePull) {
+	*out = *in
+	if in.FailedAt != nil {
+		in, out := &in.FailedAt, &out.FailedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppNodePrePull.
+func (in *CliAppNodePrePull) DeepCopy() *CliAppNodePrePull {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppNodePrePull)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppPackage) DeepCopyInto(out *CliAppPackage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppPackage.
+func (in *CliAppPackage) DeepCopy() *CliAppPackage {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppPackage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppPackagesStatus) DeepCopyInto(out *CliAppPackagesStatus) {
+	*out = *in
+	if in.Requested != nil {
+		in, out := &in.Requested, &out.Requested
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Installed != nil {
+		in, out := &in.Installed, &out.Installed
+		*out = make([]CliAppPackage, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppPackagesStatus.
+func (in *CliAppPackagesStatus) DeepCopy() *CliAppPackagesStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppPackagesStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppPinnedImages) DeepCopyInto(out *CliAppPinnedImages) {
+	*out = *in
+	if in.ToolImages != nil {
+		in, out := &in.ToolImages, &out.ToolImages
+		*out = make([]CliAppPinnedToolImage, len(*in))
+		copy(*out, *in)
+	}
+	in.ResolvedAt.DeepCopyInto(&out.ResolvedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppPinnedImages.
+func (in *CliAppPinnedImages) DeepCopy() *CliAppPinnedImages {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppPinnedImages)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppPinnedToolImage) DeepCopyInto(out *CliAppPinnedToolImage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppPinnedToolImage.
+func (in *CliAppPinnedToolImage) DeepCopy() *CliAppPinnedToolImage {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppPinnedToolImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppPrePullStatus) DeepCopyInto(out *CliAppPrePullStatus) {
+	*out = *in
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]CliAppNodePrePull, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppPrePullStatus.
+func (in *CliAppPrePullStatus) DeepCopy() *CliAppPrePullStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppPrePullStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppRollout) DeepCopyInto(out *CliAppRollout) {
+	*out = *in
+	if in.GracePeriod != nil {
+		in, out := &in.GracePeriod, &out.GracePeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppRollout.
+func (in *CliAppRollout) DeepCopy() *CliAppRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppShellHistory) DeepCopyInto(out *CliAppShellHistory) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppShellHistory.
+func (in *CliAppShellHistory) DeepCopy() *CliAppShellHistory {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppShellHistory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppShellRC) DeepCopyInto(out *CliAppShellRC) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppShellRC.
+func (in *CliAppShellRC) DeepCopy() *CliAppShellRC {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppShellRC)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CliAppSpec) DeepCopyInto(out *CliAppSpec) {
 	*out = *in
@@ -91,21 +361,103 @@ func (in *CliAppSpec) DeepCopyInto(out *CliAppSpec) {
 		*out = new(ForkObject)
 		**out = **in
 	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Packages != nil {
+		in, out := &in.Packages, &out.Packages
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Command != nil {
 		in, out := &in.Command, &out.Command
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Commands != nil {
+		in, out := &in.Commands, &out.Commands
+		*out = make(map[string][]string, len(*in))
+		for key, val := range *in {
+			var outVal []string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make([]string, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.ToolImages != nil {
+		in, out := &in.ToolImages, &out.ToolImages
+		*out = make([]CliAppToolImage, len(*in))
+		copy(*out, *in)
+	}
 	if in.HostPath != nil {
 		in, out := &in.HostPath, &out.HostPath
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Volumes != nil {
+		in, out := &in.Volumes, &out.Volumes
+		*out = make([]CliAppVolume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.Env != nil {
 		in, out := &in.Env, &out.Env
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.EnvVars != nil {
+		in, out := &in.EnvVars, &out.EnvVars
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]corev1.EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ShellRC != nil {
+		in, out := &in.ShellRC, &out.ShellRC
+		*out = new(CliAppShellRC)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ShellHistory != nil {
+		in, out := &in.ShellHistory, &out.ShellHistory
+		*out = new(CliAppShellHistory)
+		**out = **in
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.PodTemplate != nil {
+		in, out := &in.PodTemplate, &out.PodTemplate
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(CliAppRollout)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KeepAlive != nil {
+		in, out := &in.KeepAlive, &out.KeepAlive
+		*out = new(CliAppKeepAlive)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePolicy != nil {
+		in, out := &in.ImagePolicy, &out.ImagePolicy
+		*out = new(CliAppImagePolicy)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppSpec.
@@ -122,6 +474,53 @@ func (in *CliAppSpec) DeepCopy() *CliAppSpec {
 func (in *CliAppStatus) DeepCopyInto(out *CliAppStatus) {
 	*out = *in
 	in.LastPhaseTransition.DeepCopyInto(&out.LastPhaseTransition)
+	if in.RetiringPods != nil {
+		in, out := &in.RetiringPods, &out.RetiringPods
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PrePull != nil {
+		in, out := &in.PrePull, &out.PrePull
+		*out = new(CliAppPrePullStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Failure != nil {
+		in, out := &in.Failure, &out.Failure
+		*out = new(CliAppFailure)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ShellCommand != nil {
+		in, out := &in.ShellCommand, &out.ShellCommand
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ToolImages != nil {
+		in, out := &in.ToolImages, &out.ToolImages
+		*out = make([]CliAppToolImageStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Packages != nil {
+		in, out := &in.Packages, &out.Packages
+		*out = new(CliAppPackagesStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImageConfig != nil {
+		in, out := &in.ImageConfig, &out.ImageConfig
+		*out = new(CliAppImageConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PinnedImages != nil {
+		in, out := &in.PinnedImages, &out.PinnedImages
+		*out = new(CliAppPinnedImages)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppStatus.
@@ -134,6 +533,113 @@ func (in *CliAppStatus) DeepCopy() *CliAppStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppToolImage) DeepCopyInto(out *CliAppToolImage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppToolImage.
+func (in *CliAppToolImage) DeepCopy() *CliAppToolImage {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppToolImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppToolImageStatus) DeepCopyInto(out *CliAppToolImageStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppToolImageStatus.
+func (in *CliAppToolImageStatus) DeepCopy() *CliAppToolImageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppToolImageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppVolume) DeepCopyInto(out *CliAppVolume) {
+	*out = *in
+	if in.MountPropagation != nil {
+		in, out := &in.MountPropagation, &out.MountPropagation
+		*out = new(corev1.MountPropagationMode)
+		**out = **in
+	}
+	in.CliAppVolumeSource.DeepCopyInto(&out.CliAppVolumeSource)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppVolume.
+func (in *CliAppVolume) DeepCopy() *CliAppVolume {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppVolume)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppVolumeSource) DeepCopyInto(out *CliAppVolumeSource) {
+	*out = *in
+	if in.HostPath != nil {
+		in, out := &in.HostPath, &out.HostPath
+		*out = new(corev1.HostPathVolumeSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PersistentVolumeClaim != nil {
+		in, out := &in.PersistentVolumeClaim, &out.PersistentVolumeClaim
+		*out = new(corev1.PersistentVolumeClaimVolumeSource)
+		**out = **in
+	}
+	if in.Secret != nil {
+		in, out := &in.Secret, &out.Secret
+		*out = new(corev1.SecretVolumeSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(corev1.ConfigMapVolumeSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EmptyDir != nil {
+		in, out := &in.EmptyDir, &out.EmptyDir
+		*out = new(corev1.EmptyDirVolumeSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppVolumeSource.
+func (in *CliAppVolumeSource) DeepCopy() *CliAppVolumeSource {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppVolumeSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppWarmWindow) DeepCopyInto(out *CliAppWarmWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppWarmWindow.
+func (in *CliAppWarmWindow) DeepCopy() *CliAppWarmWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppWarmWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ForkObject) DeepCopyInto(out *ForkObject) {
 	*out = *in
@@ -17,6 +17,8 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
 )
@@ -36,17 +38,148 @@ type CliAppDefault struct {
 	// The context image to start an app
 	DefaultAppContextImage string `json:"defaultAppContextImage,omitempty"`
 
-	// The shell cliapp used as default. The default value is bash. You can also use zsh instead.
+	// The shell cliapp used as default. The default value is bash. It must be one of Shells.
 	DefaultShell string `json:"defaultShell,omitempty"`
 
-	// Linux distro on that the app works as default. The default value is alpine. Another supported distro is ubuntu.
+	// Linux distro on that the app works as default. The default value is alpine. It must be one of Distros.
 	DefaultDistro string `json:"defaultDistro,omitempty"`
 
+	// Linux distros apps could work on, in addition to the built-in alpine, ubuntu, debian, fedora and arch.
+	// Entries with the same name replace the built-in ones.
+	Distros map[string]CliAppDistroContext `json:"distros,omitempty"`
+
+	// Shells apps could use, in addition to the built-in bash, zsh, fish and sh.
+	// Entries with the same name replace the built-in ones.
+	Shells map[string]CliAppShellContext `json:"shells,omitempty"`
+
 	// Duration in that the background pod would be still alive even no active session opened.
 	DurationIdleLivesLast metav1.Duration `json:"maxDurationIdleLivesLast,omitempty"`
 
+	// The longest duration an outdated Pod could live for its sessions after the app spec changes.
+	// The default value is 1h.
+	RolloutGracePeriod metav1.Duration `json:"rolloutGracePeriod,omitempty"`
+
+	// Number of retries to start an app before it transits to phase Failed. The default value is 5.
+	MaxRetries int32 `json:"maxRetries,omitempty"`
+
+	// Initial interval between retries to start an app. It doubles after each retry. The default value is 10s.
+	RetryBackoff metav1.Duration `json:"retryBackoff,omitempty"`
+
+	// The longest duration a Pod could be unschedulable before the start of the app is taken as failed.
+	// The default value is 5m.
+	UnschedulableGracePeriod metav1.Duration `json:"unschedulableGracePeriod,omitempty"`
+
 	// buildkitd endpoint used to build image for app
 	BuilderService string `json:"builder,omitempty"`
+
+	// The Pod Security Standards profile apps comply with if they don't specify.
+	// Valid values are Privileged, Baseline and Restricted. The default is Privileged.
+	DefaultSecurityProfile string `json:"defaultSecurityProfile,omitempty"`
+
+	// The image which provides a statically linked busybox at /bin/busybox for apps in the Native execution mode.
+	// It keeps the workspace container alive and checks the app command. The default is busybox:musl.
+	NativeToolsImage string `json:"nativeToolsImage,omitempty"`
+
+	// How app images are mounted if apps don't specify. Valid values are CSIImage, ImageVolume and InitContainer.
+	// The first available one of them is used if not set.
+	RootfsProvider string `json:"rootfsProvider,omitempty"`
+
+	// Mirrors of registries for all images the controller renders or builds. Keys are registries,
+	// such as "docker.io", and values are mirrors which replace them, such as "registry.local:5000/docker.io".
+	RegistryMirrors map[string]string `json:"registryMirrors,omitempty"`
+
+	// Rewrite rules of images. Keys are prefixes of fully qualified image references, such as
+	// "docker.io/warmmetal/", and values are their replacements. The longest matched prefix is applied
+	// instead of registry mirrors.
+	ImagePrefixRewrites map[string]string `json:"imagePrefixRewrites,omitempty"`
+
+	// Registries accessed via plain HTTP while fetching image configuration, such as "registry.local:5000".
+	// Registries on localhost are always accessed via plain HTTP.
+	InsecureRegistries []string `json:"insecureRegistries,omitempty"`
+
+	// Compute resources of apps which don't specify their own requests or limits.
+	DefaultResources corev1.ResourceRequirements `json:"defaultResources,omitempty"`
+
+	// The maximum requests and limits of compute resources an app can set.
+	MaxResources corev1.ResourceList `json:"maxResources,omitempty"`
+
+	// Persistent homes of session users. If set, the controller provisions a PVC for each user in each app
+	// namespace, and the session gate uses it as the home of sessions the user opens in the app context.
+	// Apps must opt in by Spec.SharedUserHomes, since homes of all users of an app are shared storage which
+	// every user of the app can read and write.
+	UserHome *CliAppUserHome `json:"userHome,omitempty"`
+}
+
+// CliAppDistroContext describes how apps work on a Linux distro.
+type CliAppDistroContext struct {
+	// The app context image of the distro. "{shell}" in it is replaced with the name of the app shell.
+	ContextImage string `json:"contextImage"`
+
+	// The image apps with Packages are built on.
+	// +optional
+	BaseImage string `json:"baseImage,omitempty"`
+
+	// The package manager of BaseImage. Valid values are apk, apt, dnf and pacman.
+	// +optional
+	PackageManager string `json:"packageManager,omitempty"`
+
+	// Whether chroot of ContextImage supports "--userspec", such as the one of GNU coreutils. Commands in the
+	// app rootfs run as the image user only if it does, and as root otherwise.
+	// +optional
+	ChrootUserspec bool `json:"chrootUserspec,omitempty"`
+}
+
+// CliAppShellContext describes the shell context files and the login command of a shell.
+type CliAppShellContext struct {
+	// The rc file relative to the home directory. It is mounted from the key of the shell context ConfigMap
+	// named after its base name.
+	// +optional
+	RCFile string `json:"rcFile,omitempty"`
+
+	// The environment variable the shell reads the history file from, such as HISTFILE.
+	// The session gate sets it to a file per session to keep the history of each user.
+	// Shell history is not kept if empty.
+	// +optional
+	HistoryEnv string `json:"historyEnv,omitempty"`
+
+	// The command debug sessions run to open a login shell in the app context.
+	LoginCommand []string `json:"loginCommand"`
+
+	// The command the rc file uses to read other files. The default is ".".
+	// +optional
+	SourceCommand string `json:"sourceCommand,omitempty"`
+}
+
+type CliAppUserHomeRetentionPolicy string
+
+const (
+	CliAppUserHomeRetain CliAppUserHomeRetentionPolicy = "Retain"
+	CliAppUserHomeDelete CliAppUserHomeRetentionPolicy = "Delete"
+)
+
+// CliAppUserHome describes PVCs provisioned as homes of session users.
+type CliAppUserHome struct {
+	// StorageClass of the PVCs. The default StorageClass of the cluster is used if not set.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// The requested size of each PVC. The default is 1Gi.
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+
+	// Access modes of the PVCs, which must include ReadWriteMany. The default is ReadWriteMany.
+	// Apps of a user in the same namespace and outdated Pods which are still serving sessions share the PVC.
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+
+	// What to do with PVCs of idle users. Valid values are Retain and Delete. The default is Retain.
+	// +optional
+	RetentionPolicy CliAppUserHomeRetentionPolicy `json:"retentionPolicy,omitempty"`
+
+	// Users who open no session of an app in the period are unmounted from the app when it goes to Rest.
+	// With the Delete policy, PVCs which no app mounts in the period are deleted. The default is 168h.
+	// +optional
+	IdlePeriod metav1.Duration `json:"idlePeriod,omitempty"`
 }
 
 func init() {
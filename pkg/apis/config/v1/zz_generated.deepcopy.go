@@ -21,6 +21,7 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -29,7 +30,56 @@ func (in *CliAppDefault) DeepCopyInto(out *CliAppDefault) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ControllerManagerConfigurationSpec.DeepCopyInto(&out.ControllerManagerConfigurationSpec)
+	if in.Distros != nil {
+		in, out := &in.Distros, &out.Distros
+		*out = make(map[string]CliAppDistroContext, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Shells != nil {
+		in, out := &in.Shells, &out.Shells
+		*out = make(map[string]CliAppShellContext, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
 	out.DurationIdleLivesLast = in.DurationIdleLivesLast
+	out.RolloutGracePeriod = in.RolloutGracePeriod
+	out.RetryBackoff = in.RetryBackoff
+	out.UnschedulableGracePeriod = in.UnschedulableGracePeriod
+	if in.RegistryMirrors != nil {
+		in, out := &in.RegistryMirrors, &out.RegistryMirrors
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ImagePrefixRewrites != nil {
+		in, out := &in.ImagePrefixRewrites, &out.ImagePrefixRewrites
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.InsecureRegistries != nil {
+		in, out := &in.InsecureRegistries, &out.InsecureRegistries
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.DefaultResources.DeepCopyInto(&out.DefaultResources)
+	if in.MaxResources != nil {
+		in, out := &in.MaxResources, &out.MaxResources
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.UserHome != nil {
+		in, out := &in.UserHome, &out.UserHome
+		*out = new(CliAppUserHome)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppDefault.
@@ -49,3 +99,69 @@ func (in *CliAppDefault) DeepCopyObject() runtime.Object {
 	}
 	return nil
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppDistroContext) DeepCopyInto(out *CliAppDistroContext) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppDistroContext.
+func (in *CliAppDistroContext) DeepCopy() *CliAppDistroContext {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppDistroContext)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppShellContext) DeepCopyInto(out *CliAppShellContext) {
+	*out = *in
+	if in.LoginCommand != nil {
+		in, out := &in.LoginCommand, &out.LoginCommand
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppShellContext.
+func (in *CliAppShellContext) DeepCopy() *CliAppShellContext {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppShellContext)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CliAppUserHome) DeepCopyInto(out *CliAppUserHome) {
+	*out = *in
+	if in.StorageClassName != nil {
+		in, out := &in.StorageClassName, &out.StorageClassName
+		*out = new(string)
+		**out = **in
+	}
+	if in.Size != nil {
+		in, out := &in.Size, &out.Size
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.AccessModes != nil {
+		in, out := &in.AccessModes, &out.AccessModes
+		*out = make([]corev1.PersistentVolumeAccessMode, len(*in))
+		copy(*out, *in)
+	}
+	out.IdlePeriod = in.IdlePeriod
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CliAppUserHome.
+func (in *CliAppUserHome) DeepCopy() *CliAppUserHome {
+	if in == nil {
+		return nil
+	}
+	out := new(CliAppUserHome)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,138 @@
+package gate
+
+import (
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"path"
+	"strings"
+)
+
+const (
+	appRoot = "/app-root"
+
+	// Tool images are mounted under the directory of both the app context and the app rootfs.
+	toolsRoot = "/app-tools"
+
+	// PATH in the rootfs if the image has none.
+	defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+	// chroot is resolved in the context rather than through PATH of the image.
+	chrootPath = "/usr/sbin/chroot"
+
+	// busybox the controller installs in app containers in the Native mode.
+	nativeBusybox = "/.cliapp/busybox"
+)
+
+// appCommand returns the command run in the app rootfs, or nil if commands should run in the app context.
+// The command of the alias in Spec.Commands is used if the alias is not empty.
+func appCommand(app *appcorev1.CliApp, alias string, args []string) []string {
+	if len(alias) > 0 {
+		return append(append([]string{}, app.Spec.Commands[alias]...), args...)
+	}
+
+	if len(app.Spec.Command) > 0 {
+		return append(append([]string{}, app.Spec.Command...), args...)
+	}
+
+	if !app.Spec.UseImageEntrypoint || app.Status.ImageConfig == nil {
+		return nil
+	}
+
+	// Arguments replace the image cmd as "docker run" does.
+	if len(args) == 0 {
+		args = app.Status.ImageConfig.Cmd
+	}
+
+	command := append(append([]string{}, app.Status.ImageConfig.Entrypoint...), args...)
+	if len(command) == 0 {
+		return nil
+	}
+
+	return command
+}
+
+// runsInRootfs checks whether the command runs in the app rootfs via chroot rather than in the app context.
+func runsInRootfs(app *appcorev1.CliApp, command []string) bool {
+	return len(command) > 0 && app.Spec.ExecutionMode != appcorev1.CliAppExecutionModeNative
+}
+
+// toolPathsOf returns directories in PATH of tool images, which are mounted at the same paths in the rootfs.
+func toolPathsOf(app *appcorev1.CliApp) []string {
+	var paths []string
+	for _, tool := range app.Status.ToolImages {
+		for _, dir := range strings.Split(tool.Path, ":") {
+			if len(dir) > 0 {
+				paths = append(paths, path.Join(toolsRoot, tool.Name, dir))
+			}
+		}
+	}
+
+	return paths
+}
+
+// chrootCommand returns the command prefix to run commands in the app rootfs with variables of the session.
+// Variables of the image are restored since the workspace container has them rewritten, unless the app overrides
+// them. PATH of tool images goes after that of the image.
+// Commands run as the image user if set, which the controller only does if the chroot supports "--userspec".
+func chrootCommand(app *appcorev1.CliApp, env []string) []string {
+	config := app.Status.ImageConfig
+	if config == nil {
+		if len(env) > 0 {
+			return append(append([]string{"env"}, env...), chrootPath, appRoot)
+		}
+
+		return []string{chrootPath, appRoot}
+	}
+
+	overridden := make(map[string]bool, len(app.Spec.Env)+len(app.Spec.EnvVars))
+	for _, kv := range app.Spec.Env {
+		overridden[strings.TrimSpace(strings.SplitN(kv, "=", 2)[0])] = true
+	}
+
+	for _, env := range app.Spec.EnvVars {
+		overridden[env.Name] = true
+	}
+
+	toolPaths := toolPathsOf(app)
+	prefix := make([]string, 0, len(config.Env)+len(env)+5)
+	for _, kv := range config.Env {
+		envPair := strings.SplitN(kv, "=", 2)
+		if len(envPair) != 2 || len(envPair[0]) == 0 || overridden[envPair[0]] {
+			continue
+		}
+
+		if envPair[0] == "PATH" && len(toolPaths) > 0 {
+			kv = strings.Join(append([]string{kv}, toolPaths...), ":")
+			toolPaths = nil
+		}
+
+		prefix = append(prefix, kv)
+	}
+
+	if len(toolPaths) > 0 && !overridden["PATH"] {
+		prefix = append(prefix, "PATH="+strings.Join(append([]string{defaultPath}, toolPaths...), ":"))
+	}
+
+	prefix = append(prefix, env...)
+	if len(prefix) > 0 {
+		prefix = append([]string{"env"}, prefix...)
+	}
+
+	prefix = append(prefix, chrootPath)
+	switch config.User {
+	case "", "root", "0", "0:0":
+	default:
+		prefix = append(prefix, "--userspec="+config.User)
+	}
+
+	return append(prefix, appRoot)
+}
+
+// envCommand returns the command to set variables of commands in the app container. App images in the Native
+// mode could have no env, so the installed busybox is used.
+func envCommand(app *appcorev1.CliApp) []string {
+	if app.Spec.ExecutionMode == appcorev1.CliAppExecutionModeNative {
+		return []string{nativeBusybox, "env"}
+	}
+
+	return []string{"env"}
+}
@@ -0,0 +1,98 @@
+package gate
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+)
+
+var _ = Describe("App commands", func() {
+	newApp := func() *appcorev1.CliApp {
+		app := &appcorev1.CliApp{}
+		app.Spec.Commands = map[string][]string{"get": {"kubectl", "get"}}
+		app.Status.ImageConfig = &appcorev1.CliAppImageConfig{
+			Env:        []string{"PATH=/usr/local/bin:/usr/bin", "LANG=C.UTF-8"},
+			Entrypoint: []string{"/entrypoint"},
+			Cmd:        []string{"--help"},
+		}
+		return app
+	}
+
+	It("should pick the command of aliases, the app, or the image entrypoint", func() {
+		app := newApp()
+		Expect(appCommand(app, "", []string{"version"})).To(BeNil())
+		Expect(appCommand(app, "get", []string{"pods"})).To(Equal([]string{"kubectl", "get", "pods"}))
+
+		app.Spec.UseImageEntrypoint = true
+		Expect(appCommand(app, "", nil)).To(Equal([]string{"/entrypoint", "--help"}))
+		Expect(appCommand(app, "", []string{"version"})).To(Equal([]string{"/entrypoint", "version"}))
+
+		app.Spec.Command = []string{"kubectl"}
+		Expect(appCommand(app, "", []string{"version"})).To(Equal([]string{"kubectl", "version"}))
+		Expect(app.Spec.Command).To(Equal([]string{"kubectl"}))
+	})
+
+	It("should run commands in the rootfs only in the chroot mode without tool images", func() {
+		app := newApp()
+		Expect(runsInRootfs(app, nil)).To(BeFalse())
+		Expect(runsInRootfs(app, []string{"kubectl"})).To(BeTrue())
+
+		app.Spec.ToolImages = []appcorev1.CliAppToolImage{{Name: "kubectl", Image: "docker.io/bitnami/kubectl:latest"}}
+		Expect(runsInRootfs(app, []string{"kubectl"})).To(BeTrue())
+
+		app = newApp()
+		app.Spec.ExecutionMode = appcorev1.CliAppExecutionModeNative
+		Expect(runsInRootfs(app, []string{"kubectl"})).To(BeFalse())
+	})
+
+	It("should chroot by the absolute path with variables of the image", func() {
+		app := newApp()
+		Expect(chrootCommand(app, nil)).To(Equal([]string{
+			"env", "PATH=/usr/local/bin:/usr/bin", "LANG=C.UTF-8", chrootPath, appRoot,
+		}))
+
+		app.Spec.Env = []string{"LANG=en_US.UTF-8"}
+		app.Status.ImageConfig.User = "1000:1000"
+		Expect(chrootCommand(app, nil)).To(Equal([]string{
+			"env", "PATH=/usr/local/bin:/usr/bin", chrootPath, "--userspec=1000:1000", appRoot,
+		}))
+
+		app.Status.ImageConfig.User = "root"
+		Expect(chrootCommand(app, nil)).NotTo(ContainElement(HavePrefix("--userspec")))
+
+		Expect(chrootCommand(app, []string{"HOME=/home/cliapp/alice"})).To(Equal([]string{
+			"env", "PATH=/usr/local/bin:/usr/bin", "HOME=/home/cliapp/alice", chrootPath, appRoot,
+		}))
+
+		app.Status.ImageConfig = nil
+		Expect(chrootCommand(app, nil)).To(Equal([]string{chrootPath, appRoot}))
+		Expect(chrootCommand(app, []string{"HOME=/home/cliapp/alice"})).To(Equal([]string{
+			"env", "HOME=/home/cliapp/alice", chrootPath, appRoot,
+		}))
+	})
+
+	It("should append PATH of tool images in the rootfs", func() {
+		app := newApp()
+		app.Status.ToolImages = []appcorev1.CliAppToolImageStatus{{Name: "helm", Path: "/usr/bin:/bin"}}
+		Expect(chrootCommand(app, nil)).To(Equal([]string{
+			"env", "PATH=/usr/local/bin:/usr/bin:/app-tools/helm/usr/bin:/app-tools/helm/bin", "LANG=C.UTF-8",
+			chrootPath, appRoot,
+		}))
+
+		app.Status.ImageConfig.Env = nil
+		Expect(chrootCommand(app, nil)).To(Equal([]string{
+			"env", "PATH=" + defaultPath + ":/app-tools/helm/usr/bin:/app-tools/helm/bin", chrootPath, appRoot,
+		}))
+
+		app.Spec.Env = []string{"PATH=/bin"}
+		Expect(chrootCommand(app, nil)).To(Equal([]string{chrootPath, appRoot}))
+	})
+
+	It("should set variables via busybox in the Native mode", func() {
+		app := newApp()
+		Expect(envCommand(app)).To(Equal([]string{"env"}))
+
+		app.Spec.ExecutionMode = appcorev1.CliAppExecutionModeNative
+		Expect(envCommand(app)).To(Equal([]string{nativeBusybox, "env"}))
+	})
+})
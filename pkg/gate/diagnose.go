@@ -0,0 +1,125 @@
+package gate
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"time"
+)
+
+// podObserver reports how app Pods are getting ready, such as scheduling, image pulling and volume mounting.
+type podObserver struct {
+	since time.Time
+
+	// last reported states of each Pod
+	pods map[string]*podState
+
+	// counts of reported events
+	events map[types.UID]int32
+}
+
+type podState struct {
+	scheduled    string
+	unscheduled  string
+	waitReasons  map[string]string
+	terminations map[string]string
+}
+
+func newPodObserver() *podObserver {
+	return &podObserver{
+		since:  time.Now(),
+		pods:   make(map[string]*podState),
+		events: make(map[types.UID]int32),
+	}
+}
+
+func (o *podObserver) onPod(pod *corev1.Pod, progress *progressWriter) {
+	if pod.DeletionTimestamp != nil {
+		return
+	}
+
+	state := o.pods[pod.Name]
+	if state == nil {
+		state = &podState{
+			waitReasons:  make(map[string]string),
+			terminations: make(map[string]string),
+		}
+		o.pods[pod.Name] = state
+		progress.WriteLn(fmt.Sprintf("Pod %s is created", pod.Name))
+	}
+
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type != corev1.PodScheduled {
+			continue
+		}
+
+		if cond.Status == corev1.ConditionTrue {
+			if len(pod.Spec.NodeName) > 0 && state.scheduled != pod.Spec.NodeName {
+				state.scheduled = pod.Spec.NodeName
+				progress.WriteLn(fmt.Sprintf("Pod %s is scheduled to node %s", pod.Name, pod.Spec.NodeName))
+			}
+		} else if len(cond.Message) > 0 && state.unscheduled != cond.Message {
+			state.unscheduled = cond.Message
+			progress.WriteLn(fmt.Sprintf("Pod %s can't be scheduled: %s", pod.Name, cond.Message))
+		}
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Waiting != nil {
+			desc := status.State.Waiting.Reason
+			if len(status.State.Waiting.Message) > 0 {
+				desc = fmt.Sprintf("%s: %s", desc, status.State.Waiting.Message)
+			}
+
+			if len(desc) > 0 && state.waitReasons[status.Name] != desc {
+				state.waitReasons[status.Name] = desc
+				progress.WriteLn(fmt.Sprintf("container %s is waiting: %s", status.Name, desc))
+			}
+		}
+
+		if status.LastTerminationState.Terminated != nil {
+			terminated := status.LastTerminationState.Terminated
+			desc := fmt.Sprintf("%s(exit code %d)", terminated.Reason, terminated.ExitCode)
+			if len(terminated.Message) > 0 {
+				desc = fmt.Sprintf("%s: %s", desc, terminated.Message)
+			}
+
+			if state.terminations[status.Name] != desc {
+				state.terminations[status.Name] = desc
+				progress.WriteLn(fmt.Sprintf("container %s terminated: %s", status.Name, desc))
+			}
+		}
+	}
+}
+
+func eventTime(ev *corev1.Event) time.Time {
+	if !ev.LastTimestamp.IsZero() {
+		return ev.LastTimestamp.Time
+	}
+
+	if !ev.EventTime.IsZero() {
+		return ev.EventTime.Time
+	}
+
+	return ev.CreationTimestamp.Time
+}
+
+func (o *podObserver) onEvent(ev *corev1.Event, progress *progressWriter) {
+	if ev.InvolvedObject.Kind != "Pod" || o.pods[ev.InvolvedObject.Name] == nil {
+		return
+	}
+
+	// Events happened before the session are skipped. Timestamps of events are in seconds.
+	if eventTime(ev).Before(o.since.Truncate(time.Second)) {
+		return
+	}
+
+	if count, found := o.events[ev.UID]; found && count == ev.Count {
+		return
+	}
+
+	o.events[ev.UID] = ev.Count
+	progress.WriteLn(fmt.Sprintf("%s: %s", ev.Reason, ev.Message))
+}
@@ -0,0 +1,121 @@
+package gate
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	rpc "github.com/warm-metal/cliapp/pkg/session"
+	"google.golang.org/grpc"
+	"io"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
+)
+
+// recordingStream is a shell stream which records outputs sent to the client.
+type recordingStream struct {
+	grpc.ServerStream
+	outputs []string
+}
+
+func (s *recordingStream) Recv() (*rpc.StdIn, error) {
+	return nil, io.EOF
+}
+
+func (s *recordingStream) Send(out *rpc.StdOut) error {
+	s.outputs = append(s.outputs, string(out.Output))
+	return nil
+}
+
+// drain returns outputs sent since the last call.
+func (s *recordingStream) drain() []string {
+	outputs := s.outputs
+	s.outputs = nil
+	return outputs
+}
+
+var _ = Describe("Pod observer", func() {
+	var stream *recordingStream
+	var progress *progressWriter
+	var observer *podObserver
+
+	BeforeEach(func() {
+		stream = &recordingStream{}
+		progress = newProgressWriter(stream)
+		observer = newPodObserver()
+	})
+
+	It("should relay changes of Pod states once", func() {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app"}}
+		observer.onPod(pod, progress)
+		Expect(stream.drain()).To(ConsistOf(ContainSubstring("Pod app is created")))
+
+		pod.Status.Conditions = []corev1.PodCondition{{
+			Type:    corev1.PodScheduled,
+			Status:  corev1.ConditionFalse,
+			Message: "0/3 nodes are available",
+		}}
+		observer.onPod(pod, progress)
+		observer.onPod(pod, progress)
+		Expect(stream.drain()).To(ConsistOf(ContainSubstring("Pod app can't be scheduled: 0/3 nodes are available")))
+
+		pod.Spec.NodeName = "node-1"
+		pod.Status.Conditions[0].Status = corev1.ConditionTrue
+		pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+			Name: "tools",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+				Reason: "ErrImagePull", Message: "not found",
+			}},
+		}}
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name: "workspace",
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				Reason: "Error", ExitCode: 1,
+			}},
+		}}
+		observer.onPod(pod, progress)
+		observer.onPod(pod, progress)
+		Expect(stream.drain()).To(ConsistOf(
+			ContainSubstring("Pod app is scheduled to node node-1"),
+			ContainSubstring("container tools is waiting: ErrImagePull: not found"),
+			ContainSubstring("container workspace terminated: Error(exit code 1)"),
+		))
+
+		pod.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		pod.Status.InitContainerStatuses[0].State.Waiting.Reason = "ImagePullBackOff"
+		observer.onPod(pod, progress)
+		Expect(stream.drain()).To(BeEmpty())
+	})
+
+	It("should relay new events of observed Pods", func() {
+		observer.onPod(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app"}}, progress)
+		stream.drain()
+
+		now := metav1.Now()
+		ev := &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{UID: "event-1"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "app"},
+			Reason:         "Pulling",
+			Message:        "Pulling image busybox",
+			Count:          1,
+			LastTimestamp:  now,
+		}
+		observer.onEvent(ev, progress)
+		observer.onEvent(ev, progress)
+		Expect(stream.drain()).To(ConsistOf(ContainSubstring("Pulling: Pulling image busybox")))
+
+		ev.Count++
+		observer.onEvent(ev, progress)
+		Expect(stream.drain()).To(HaveLen(1))
+
+		other := ev.DeepCopy()
+		other.UID = "event-2"
+		other.InvolvedObject.Name = "other"
+		observer.onEvent(other, progress)
+
+		stale := ev.DeepCopy()
+		stale.UID = "event-3"
+		stale.LastTimestamp = metav1.NewTime(observer.since.Add(-time.Minute))
+		observer.onEvent(stale, progress)
+		Expect(stream.drain()).To(BeEmpty())
+	})
+})
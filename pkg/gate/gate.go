@@ -2,6 +2,7 @@ package gate
 
 import (
 	"context"
+	"fmt"
 	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
 	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
 	rpc "github.com/warm-metal/cliapp/pkg/session"
@@ -17,14 +18,30 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/remotecommand"
 	"k8s.io/client-go/util/exec"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
+	"strconv"
 	"sync"
 	"time"
 )
 
-func PrepareGate(s *grpc.Server) {
+const (
+	appLabel        = "cliapp.warm-metal.tech"
+	annoKeySessions = "cliapp.warm-metal.tech/sessions"
+
+	// The session count of a Pod is a lease the gate renews while sessions are open. The controller ignores the
+	// count if it is not renewed in sessionLeaseDuration, e.g. the gate crashed without closing sessions.
+	annoKeySessionsRenewedAt = "cliapp.warm-metal.tech/sessions-renewed-at"
+	sessionLeaseRenewPeriod  = time.Minute
+	sessionLeaseDuration     = 3 * time.Minute
+)
+
+// PrepareGate registers the session gate to the gRPC server.
+// Sessions would be closed if apps are not ready in startupTimeout. Zero startupTimeout means no timeout.
+func PrepareGate(s *grpc.Server, startupTimeout time.Duration) {
 	gate := terminalGate{
-		sessionMap: make(map[types.NamespacedName]*appSession),
+		sessionMap:     make(map[types.NamespacedName]*appSession),
+		startupTimeout: startupTimeout,
 	}
 	gate.init()
 	rpc.RegisterAppGateServer(s, &gate)
@@ -37,6 +54,8 @@ type terminalGate struct {
 
 	sessionMap   map[types.NamespacedName]*appSession
 	sessionGuard sync.Mutex
+
+	startupTimeout time.Duration
 }
 
 func timeoutContext(parent ...context.Context) (context.Context, context.CancelFunc) {
@@ -78,7 +97,10 @@ func (t *terminalGate) init() {
 	}
 }
 
-func (t *terminalGate) attach(app *appcorev1.CliApp, cmd []string, in *clientReader, stdout io.Writer) (err error) {
+func (t *terminalGate) attach(
+	app *appcorev1.CliApp, alias string, cmd []string, env []string, history *sessionHistory, in *clientReader,
+	stdout io.Writer,
+) (err error) {
 	opts := &corev1.PodExecOptions{
 		Container: "workspace",
 		Stdin:     true,
@@ -87,11 +109,29 @@ func (t *terminalGate) attach(app *appcorev1.CliApp, cmd []string, in *clientRea
 		TTY:       true,
 	}
 
-	if len(app.Spec.Command) > 0 {
-		opts.Command = append([]string{"chroot", "/app-root"}, append(app.Spec.Command, cmd...)...)
-	} else {
+	if command := appCommand(app, alias, cmd); len(command) > 0 {
+		opts.Command = command
+		if runsInRootfs(app, command) {
+			opts.Command = append(chrootCommand(app, env), command...)
+		}
+	} else if len(cmd) > 0 {
 		// For debug command, the cmd usually is bash or zsh.
 		opts.Command = cmd
+	} else {
+		// Open a login shell of the app context if the client specifies no command.
+		opts.Command = app.Status.ShellCommand
+		if len(opts.Command) == 0 && app.Spec.ExecutionMode == appcorev1.CliAppExecutionModeNative {
+			opts.Command = []string{nativeBusybox, "sh"}
+		}
+	}
+
+	if history != nil {
+		opts.Command = history.command(opts.Command)
+	}
+
+	// Variables of commands in the app rootfs are set by the chroot prefix.
+	if len(env) > 0 && !runsInRootfs(app, appCommand(app, alias, cmd)) {
+		opts.Command = append(append(envCommand(app), env...), opts.Command...)
 	}
 
 	req := t.clientset.CoreV1().RESTClient().Post().
@@ -107,6 +147,22 @@ func (t *terminalGate) attach(app *appcorev1.CliApp, cmd []string, in *clientRea
 
 	klog.Infof("open session to Pod %s/%s", app.Namespace, app.Status.PodName)
 
+	// Count sessions on the Pod, so that the controller would keep it until all sessions closed
+	// even if the app spec changes.
+	if err := t.countSessions(app.Namespace, app.Status.PodName, 1); err != nil {
+		klog.Errorf("unable to count sessions of Pod %s/%s: %s", app.Namespace, app.Status.PodName, err)
+	}
+
+	stopRenewing := make(chan struct{})
+	go t.renewSessions(app.Namespace, app.Status.PodName, stopRenewing)
+
+	defer func() {
+		close(stopRenewing)
+		if err := t.countSessions(app.Namespace, app.Status.PodName, -1); err != nil {
+			klog.Errorf("unable to count sessions of Pod %s/%s: %s", app.Namespace, app.Status.PodName, err)
+		}
+	}()
+
 	err = remoteExec.Stream(remotecommand.StreamOptions{
 		Stdin:             in,
 		Stdout:            stdout,
@@ -117,6 +173,68 @@ func (t *terminalGate) attach(app *appcorev1.CliApp, cmd []string, in *clientRea
 	return
 }
 
+func (t *terminalGate) countSessions(namespace, podName string, delta int) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		ctx, cancel := timeoutContext()
+		defer cancel()
+		pod, err := t.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		// Sessions of an expired lease are gone with the gate that opened them.
+		sessions := 0
+		if sessionLeaseValid(pod.Annotations[annoKeySessionsRenewedAt]) {
+			sessions, _ = strconv.Atoi(pod.Annotations[annoKeySessions])
+		}
+
+		sessions += delta
+		if sessions < 0 {
+			sessions = 0
+		}
+
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+
+		pod.Annotations[annoKeySessions] = strconv.Itoa(sessions)
+		pod.Annotations[annoKeySessionsRenewedAt] = time.Now().UTC().Format(time.RFC3339)
+		ctx2, cancel2 := timeoutContext()
+		defer cancel2()
+		_, err = t.clientset.CoreV1().Pods(namespace).Update(ctx2, pod, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func sessionLeaseValid(renewedAt string) bool {
+	at, err := time.Parse(time.RFC3339, renewedAt)
+	return err == nil && time.Since(at) < sessionLeaseDuration
+}
+
+// renewSessions renews the session lease of the Pod until stop is closed.
+func (t *terminalGate) renewSessions(namespace, podName string, stop <-chan struct{}) {
+	ticker := time.NewTicker(sessionLeaseRenewPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`,
+			annoKeySessionsRenewedAt, time.Now().UTC().Format(time.RFC3339))
+		ctx, cancel := timeoutContext()
+		_, err := t.clientset.CoreV1().Pods(namespace).Patch(
+			ctx, podName, types.MergePatchType, []byte(patch), metav1.PatchOptions{},
+		)
+		cancel()
+		if err != nil {
+			klog.Errorf("unable to renew sessions of Pod %s/%s: %s", namespace, podName, err)
+		}
+	}
+}
+
 func (t *terminalGate) OpenShell(s rpc.AppGate_OpenShellServer) error {
 	req, err := s.Recv()
 	if err != nil {
@@ -136,11 +254,45 @@ func (t *terminalGate) OpenShell(s rpc.AppGate_OpenShellServer) error {
 		Name:      req.App.Name,
 	}
 
+	// Users are authenticated before the session is counted, so that rejected requests don't close it.
+	var user string
+	if len(req.Token) > 0 {
+		if !overTLS(s.Context()) {
+			return status.Error(codes.FailedPrecondition, "tokens are only accepted over TLS")
+		}
+
+		if user, err = t.authenticate(s.Context(), req.Token); err != nil {
+			klog.Errorf("unable to authenticate the user of app %s. Neither history nor home is kept: %s",
+				&sessionKey, err)
+		} else if err = t.recordHomeUser(s.Context(), &sessionKey, user); err != nil {
+			klog.Errorf("unable to record user %s in app %s: %s", user, &sessionKey, err)
+		}
+	}
+
+	// Check the alias before the app is woken up.
+	if len(req.Alias) > 0 {
+		ctx, cancel := timeoutContext(s.Context())
+		app, err := t.appClient.CliappV1().CliApps(sessionKey.Namespace).Get(ctx, sessionKey.Name, metav1.GetOptions{})
+		cancel()
+		if err != nil {
+			klog.Errorf("unable to fetch app %s: %s", &sessionKey, err)
+			return status.Error(codes.Unavailable, err.Error())
+		}
+
+		if len(app.Spec.Commands[req.Alias]) == 0 {
+			return status.Errorf(codes.InvalidArgument, "app %s has no command alias %q", &sessionKey, req.Alias)
+		}
+	}
+
 	t.sessionGuard.Lock()
 
 	session := t.sessionMap[sessionKey]
 	if session == nil {
-		session = &appSession{appClient: t.appClient}
+		session = &appSession{
+			appClient:      t.appClient,
+			clientset:      t.clientset,
+			startupTimeout: t.startupTimeout,
+		}
 		t.sessionMap[sessionKey] = session
 	}
 
@@ -155,16 +307,44 @@ func (t *terminalGate) OpenShell(s rpc.AppGate_OpenShellServer) error {
 	}()
 
 	klog.Infof("open app %s", &sessionKey)
-	app, err := session.open(s.Context(), newProgressWriter(s), &sessionKey)
+	progress := newProgressWriter(s)
+	app, err := session.open(s.Context(), progress, &sessionKey)
 	if err != nil {
 		klog.Errorf("unable to open app %s: %s", &sessionKey, err)
 		return status.Error(codes.Unavailable, err.Error())
 	}
 
+	// The alias could be removed while the app is starting.
+	if len(req.Alias) > 0 && len(app.Spec.Commands[req.Alias]) == 0 {
+		return status.Errorf(codes.InvalidArgument, "app %s has no command alias %q", &sessionKey, req.Alias)
+	}
+
 	stdin, stdout := genClientIOStreams(s, req.TerminalSize)
 	defer stdin.Close()
 
-	if err = t.attach(app, req.Input, stdin, stdout); err != nil {
+	var env []string
+	command := appCommand(app, req.Alias, req.Input)
+	if len(user) > 0 && len(app.Status.UserHomeDir) > 0 {
+		if home := t.homeOf(s.Context(), progress, app, user); len(home) > 0 {
+			env = append(env, "HOME="+home)
+		}
+	}
+
+	var history *sessionHistory
+	if command == nil {
+		if history = t.openHistory(s.Context(), app, req, user); history != nil {
+			env = append(env, history.env()...)
+			defer func() {
+				ctx, cancel := timeoutContext()
+				defer cancel()
+				if err := t.closeHistory(ctx, history); err != nil {
+					klog.Errorf("unable to save history of app %s: %s", &sessionKey, err)
+				}
+			}()
+		}
+	}
+
+	if err = t.attach(app, req.Alias, req.Input, env, history, stdin, stdout); err != nil {
 		if details, ok := err.(exec.CodeExitError); ok {
 			klog.Errorf("unable to open stream of app %s: %s", &sessionKey, details.Err.Error())
 			return status.Errorf(codes.Aborted, "%d", details.Code)
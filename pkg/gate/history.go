@@ -0,0 +1,231 @@
+package gate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	rpc "github.com/warm-metal/cliapp/pkg/session"
+	"golang.org/x/xerrors"
+	"io"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	"path"
+)
+
+const (
+	// The Secret in the app namespace which keeps shell history of all users and apps.
+	historySecret = "cliapp-shell-history"
+
+	// The directory in the workspace container history files are restored to and collected from. Sessions run
+	// in their own mount namespaces with a tmpfs over the directory, so a history file only stays in the shared
+	// directory until the session moves it into its tmpfs, and after the session exits until it is collected.
+	historyDir = "/tmp/.cliapp-history"
+
+	defaultHistoryMaxLines = 1000
+
+	// The maximum size of the history of a user.
+	maxHistoryBytes = 64 << 10
+
+	// Secrets are limited to 1MiB.
+	maxHistorySecretBytes = 900 << 10
+)
+
+// sessionHistory is the shell history of a user in a session.
+type sessionHistory struct {
+	app      *appcorev1.CliApp
+	key      string
+	file     string
+	maxLines int
+}
+
+// historyKeyOf returns the key of the history of the user and the app in the Secret.
+func historyKeyOf(app, user string) string {
+	return fmt.Sprintf("%s.%s", app, userKeyOf(user))
+}
+
+// privateHistoryScript moves the history file $0 into a tmpfs over the directory $1 in the mount namespace of
+// the session, runs the shell in the rest arguments, then moves the history back. Signals of the terminal are
+// caught so that the history is still moved back if the shell is killed by them.
+const privateHistoryScript = `trap : HUP INT QUIT
+dir=$1 && shift
+history=$(cat "$0") && rm -f "$0" && mount -t tmpfs -o mode=0700 cliapp-history "$dir" || exit 1
+[ -z "$history" ] || (umask 077 && printf '%s\n' "$history" > "$0")
+"$@"
+code=$?
+history=$(cat "$0" 2>/dev/null)
+umount "$dir" && [ -n "$history" ] && (umask 077 && printf '%s\n' "$history" > "$0")
+exit $code`
+
+// truncateHistory keeps the tail of the history in both the maximum lines and bytes.
+func truncateHistory(history []byte, maxLines, maxBytes int) []byte {
+	history = bytes.TrimRight(history, "\n")
+	if len(history) == 0 {
+		return nil
+	}
+
+	lines := bytes.Split(history, []byte("\n"))
+	if len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+
+	size := 0
+	first := len(lines)
+	for ; first > 0; first-- {
+		size += len(lines[first-1]) + 1
+		if size > maxBytes {
+			break
+		}
+	}
+
+	if first == len(lines) {
+		return nil
+	}
+
+	return append(bytes.Join(lines[first:], []byte("\n")), '\n')
+}
+
+// fitHistory drops the oldest lines of the history of the key so that all histories fit in the size.
+func fitHistory(histories map[string][]byte, key string, history []byte, size int) ([]byte, error) {
+	size -= len(key)
+	for k, v := range histories {
+		if k != key {
+			size -= len(k) + len(v)
+		}
+	}
+
+	if size <= 0 {
+		return nil, xerrors.Errorf("Secret %s is full", historySecret)
+	}
+
+	return truncateHistory(history, len(history)+1, size), nil
+}
+
+// exec runs the command in the workspace container without a terminal.
+func (t *terminalGate) exec(app *appcorev1.CliApp, command []string, stdin io.Reader, stdout io.Writer) error {
+	opts := &corev1.PodExecOptions{
+		Container: "workspace",
+		Command:   command,
+		Stdin:     stdin != nil,
+		Stdout:    stdout != nil,
+		Stderr:    true,
+	}
+
+	req := t.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").Name(app.Status.PodName).Namespace(app.Namespace).
+		SubResource("exec").
+		VersionedParams(opts, scheme.ParameterCodec)
+
+	remoteExec, err := remotecommand.NewSPDYExecutor(t.config, "POST", req.URL())
+	if err != nil {
+		return xerrors.Errorf("can't create executor: %s", err)
+	}
+
+	stderr := &bytes.Buffer{}
+	err = remoteExec.Stream(remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	if err != nil {
+		return xerrors.Errorf("%s: %s", err, stderr.String())
+	}
+
+	return nil
+}
+
+// openHistory restores the history of the authenticated session user into a file in the workspace container.
+// It returns nil if no history should be kept, in which case nothing is written.
+func (t *terminalGate) openHistory(
+	ctx context.Context, app *appcorev1.CliApp, req *rpc.StdIn, user string,
+) *sessionHistory {
+	if len(user) == 0 || req.NoHistory || len(app.Status.ShellHistoryEnv) == 0 ||
+		app.Spec.ShellHistory != nil && app.Spec.ShellHistory.Disabled {
+		return nil
+	}
+
+	h := &sessionHistory{
+		app:      app,
+		key:      historyKeyOf(app.Name, user),
+		maxLines: defaultHistoryMaxLines,
+	}
+	h.file = path.Join(historyDir, fmt.Sprintf("%s.%s", h.key, rand.String(8)))
+	if app.Spec.ShellHistory != nil && app.Spec.ShellHistory.MaxLines > 0 {
+		h.maxLines = int(app.Spec.ShellHistory.MaxLines)
+	}
+
+	var history []byte
+	secret, err := t.clientset.CoreV1().Secrets(app.Namespace).Get(ctx, historySecret, metav1.GetOptions{})
+	if err == nil {
+		history = secret.Data[h.key]
+	} else if !errors.IsNotFound(err) {
+		klog.Errorf("unable to fetch history of app %s/%s: %s", app.Namespace, app.Name, err)
+		return nil
+	}
+
+	// History is not kept if it can't be hidden from other sessions.
+	err = t.exec(app, []string{
+		"sh", "-c", `umask 077 && mkdir -p "$0" && unshare -m mount -t tmpfs cliapp-history "$0" && cat > "$1"`,
+		historyDir, h.file,
+	}, bytes.NewReader(history), nil)
+	if err != nil {
+		klog.Errorf("unable to restore history of app %s/%s: %s", app.Namespace, app.Name, err)
+		return nil
+	}
+
+	return h
+}
+
+// env returns environment variables of the shell to use the history file.
+func (h *sessionHistory) env() []string {
+	return []string{fmt.Sprintf("%s=%s", h.app.Status.ShellHistoryEnv, h.file)}
+}
+
+// command wraps the shell command to run in its own mount namespace, where the history file is private.
+func (h *sessionHistory) command(shell []string) []string {
+	return append([]string{"unshare", "-m", "sh", "-c", privateHistoryScript, h.file, historyDir}, shell...)
+}
+
+// closeHistory collects the history file and saves it to the Secret.
+func (t *terminalGate) closeHistory(ctx context.Context, h *sessionHistory) error {
+	history := &bytes.Buffer{}
+	err := t.exec(h.app, []string{"sh", "-c", `cat "$0" && rm -f "$0"`, h.file}, nil, history)
+	if err != nil {
+		return xerrors.Errorf("unable to collect history: %s", err)
+	}
+
+	data := truncateHistory(history.Bytes(), h.maxLines, maxHistoryBytes)
+	secrets := t.clientset.CoreV1().Secrets(h.app.Namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := secrets.Get(ctx, historySecret, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			_, err = secrets.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: historySecret, Namespace: h.app.Namespace},
+				Type:       corev1.SecretTypeOpaque,
+				Data:       map[string][]byte{h.key: data},
+			}, metav1.CreateOptions{})
+			return err
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+
+		if secret.Data[h.key], err = fitHistory(secret.Data, h.key, data, maxHistorySecretBytes); err != nil {
+			return err
+		}
+
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,47 @@
+package gate
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"strings"
+)
+
+var _ = Describe("Shell history", func() {
+	It("should keep the history per app and user", func() {
+		Expect(historyKeyOf("kubectl", "alice")).To(Equal("kubectl." + userKeyOf("alice")))
+		Expect(historyKeyOf("kubectl", "alice")).NotTo(Equal(historyKeyOf("kubectl", "bob")))
+		Expect(historyKeyOf("kubectl", "alice")).NotTo(Equal(historyKeyOf("helm", "alice")))
+	})
+
+	It("should keep the tail of the history", func() {
+		Expect(truncateHistory(nil, 10, 100)).To(BeNil())
+		Expect(truncateHistory([]byte("\n\n"), 10, 100)).To(BeNil())
+		Expect(string(truncateHistory([]byte("ls\npwd"), 10, 100))).To(Equal("ls\npwd\n"))
+		Expect(string(truncateHistory([]byte("ls\npwd\nid\n"), 2, 100))).To(Equal("pwd\nid\n"))
+		Expect(string(truncateHistory([]byte("ls\npwd\nid\n"), 10, 7))).To(Equal("pwd\nid\n"))
+
+		long := strings.Repeat("x", 10)
+		Expect(truncateHistory([]byte("ls\n"+long), 10, 5)).To(BeNil())
+	})
+
+	It("should drop the oldest lines if the Secret is full", func() {
+		histories := map[string][]byte{"helm.bob": []byte("helm ls\n"), "kubectl.alice": []byte("ls\n")}
+		history, err := fitHistory(histories, "kubectl.alice", []byte("ls\npwd\nid\n"), 100)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(history)).To(Equal("ls\npwd\nid\n"))
+
+		history, err = fitHistory(histories, "kubectl.alice", []byte("ls\npwd\nid\n"), 36)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(history)).To(Equal("pwd\nid\n"))
+
+		_, err = fitHistory(histories, "kubectl.alice", []byte("ls\n"), 29)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should run the shell in its own mount namespace", func() {
+		h := &sessionHistory{file: historyDir + "/kubectl.alice.abcdefgh"}
+		command := h.command([]string{"bash", "-l"})
+		Expect(command[:3]).To(Equal([]string{"unshare", "-m", "sh"}))
+		Expect(command[5:]).To(Equal([]string{h.file, historyDir, "bash", "-l"}))
+	})
+})
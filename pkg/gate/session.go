@@ -2,23 +2,32 @@ package gate
 
 import (
 	"context"
+	"fmt"
 	"github.com/fatih/color"
 	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
 	appv1 "github.com/warm-metal/cliapp/pkg/clientset/versioned"
 	rpc "github.com/warm-metal/cliapp/pkg/session"
 	"go.uber.org/atomic"
 	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 	"sync"
+	"time"
 )
 
 type appSession struct {
 	appClient *appv1.Clientset
+	clientset *kubernetes.Clientset
+
+	// The longest duration to wait for the app to be Live.
+	startupTimeout time.Duration
 
 	activeCount atomic.Int32
 	app         *appcorev1.CliApp
@@ -39,7 +48,7 @@ func (t *appSession) open(
 
 	// The t.app could be nil if the remote spec changes are committing.
 	if active > 1 && t.app != nil {
-		return t.app, nil
+		return t.refreshApp(ctx, name), nil
 	}
 
 	err = <-t.remoteOpen(ctx, progress, name)
@@ -47,6 +56,27 @@ func (t *appSession) open(
 	return
 }
 
+// refreshApp fetches the latest app, so that new sessions are sent to the new Pod once the app spec changes.
+// Sessions go to the current Pod if the new Pod is not ready yet.
+func (t *appSession) refreshApp(parent context.Context, name *types.NamespacedName) *appcorev1.CliApp {
+	t.guard.Lock()
+	defer t.guard.Unlock()
+
+	ctx, cancel := timeoutContext(parent)
+	defer cancel()
+	app, err := t.appClient.CliappV1().CliApps(name.Namespace).Get(ctx, name.Name, metav1.GetOptions{})
+	if err != nil {
+		klog.Errorf("unable to fetch app %s: %s", name, err)
+		return t.app
+	}
+
+	if t.app != nil && app.Status.Phase == appcorev1.CliAppPhaseLive && len(app.Status.PodName) > 0 {
+		t.app = app
+	}
+
+	return t.app
+}
+
 func (t *appSession) close(ctx context.Context, name *types.NamespacedName) (err error) {
 	active := t.activeCount.Sub(1)
 	if active < 0 {
@@ -201,7 +231,9 @@ func (t *appSession) startApp(
 			return err
 		}
 
-		if app.Status.Phase == appcorev1.CliAppPhaseLive || app.Spec.TargetPhase == appcorev1.CliAppPhaseLive {
+		// Apps kept alive by their policies could be Live while their TargetPhase is Rest.
+		// TargetPhase is still set to keep them Live until sessions close.
+		if app.Spec.TargetPhase == appcorev1.CliAppPhaseLive {
 			return nil
 		}
 
@@ -221,7 +253,14 @@ func (t *appSession) startApp(
 		return
 	}
 
-	ctx, cancel := context.WithCancel(parent)
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if t.startupTimeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, t.startupTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+
 	defer cancel()
 	watcher, err := t.appClient.CliappV1().CliApps(app.Namespace).Watch(ctx, metav1.ListOptions{
 		FieldSelector: fields.Set{"metadata.name": app.Name}.AsSelector().String(),
@@ -233,6 +272,29 @@ func (t *appSession) startApp(
 
 	defer watcher.Stop()
 
+	var podCh, eventCh <-chan watch.Event
+	podWatcher, failed := t.clientset.CoreV1().Pods(app.Namespace).Watch(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{appLabel: app.Name}.AsSelector().String(),
+	})
+	if failed != nil {
+		klog.Errorf("unable to watch pods of app %s: %s", name, failed)
+	} else {
+		defer podWatcher.Stop()
+		podCh = podWatcher.ResultChan()
+	}
+
+	eventWatcher, failed := t.clientset.CoreV1().Events(app.Namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{"involvedObject.kind": "Pod"}.AsSelector().String(),
+	})
+	if failed != nil {
+		klog.Errorf("unable to watch events of app %s: %s", name, failed)
+	} else {
+		defer eventWatcher.Stop()
+		eventCh = eventWatcher.ResultChan()
+	}
+
+	observer := newPodObserver()
+	var reportedRetries int32
 	for {
 		select {
 		case ev, ok := <-watcher.ResultChan():
@@ -248,7 +310,21 @@ func (t *appSession) startApp(
 					return
 				}
 
-				if len(app.Status.Error) > 0 {
+				if app.Status.Phase == appcorev1.CliAppPhaseFailed && app.Status.Failure != nil {
+					err = xerrors.Errorf("app failed after %d retries: %s: %s",
+						app.Status.Failure.Retries, app.Status.Failure.Reason, app.Status.Failure.Message)
+					return
+				}
+
+				if app.Status.Failure != nil {
+					if app.Status.Failure.Retries == reportedRetries {
+						continue
+					}
+
+					reportedRetries = app.Status.Failure.Retries
+					progress.WriteLn(fmt.Sprintf("retrying(%d) since %s: %s",
+						app.Status.Failure.Retries, app.Status.Failure.Reason, app.Status.Failure.Message))
+				} else if len(app.Status.Error) > 0 {
 					err = xerrors.New(app.Status.Error)
 					return
 				}
@@ -281,8 +357,31 @@ func (t *appSession) startApp(
 				panic(ev.Type)
 			}
 
+		case ev, ok := <-podCh:
+			if !ok {
+				podCh = nil
+				continue
+			}
+
+			if pod, isPod := ev.Object.(*corev1.Pod); isPod && ev.Type != watch.Deleted {
+				observer.onPod(pod, progress)
+			}
+
+		case ev, ok := <-eventCh:
+			if !ok {
+				eventCh = nil
+				continue
+			}
+
+			if event, isEvent := ev.Object.(*corev1.Event); isEvent && ev.Type != watch.Deleted {
+				observer.onEvent(event, progress)
+			}
+
 		case <-ctx.Done():
-			if ctx.Err() != nil {
+			if ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+				err = xerrors.Errorf("app %s isn't ready in %s. Check its status and events for details",
+					name, t.startupTimeout)
+			} else if ctx.Err() != nil {
 				err = ctx.Err()
 			} else {
 				err = xerrors.Errorf("context closed")
@@ -0,0 +1,144 @@
+package gate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
+	"golang.org/x/xerrors"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	authv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// annotation of apps users are recorded in, as a JSON map from user keys to the time of their last sessions,
+	// so that the controller mounts their homes. The same annotation of Pods is user keys whose homes are mounted.
+	annoKeyHomeUsers = "cliapp.warm-metal.tech/home-users"
+
+	// The time of the last session of a user is refreshed at most once in the interval.
+	homeUserRecordInterval = time.Hour
+)
+
+// userKeyOf returns the key of the user in history and homes.
+// Users are hashed since user names could contain characters which keys and paths don't allow.
+func userKeyOf(user string) string {
+	sum := sha256.Sum256([]byte(user))
+	return hex.EncodeToString(sum[:16])
+}
+
+// overTLS checks whether the client connects to the gate over TLS, so that its token is not exposed.
+func overTLS(ctx context.Context) bool {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+
+	_, ok = p.AuthInfo.(credentials.TLSInfo)
+	return ok
+}
+
+// authenticate returns the name of the user who owns the token.
+func (t *terminalGate) authenticate(ctx context.Context, token string) (string, error) {
+	review, err := t.clientset.AuthenticationV1().TokenReviews().Create(ctx, &authv1.TokenReview{
+		Spec: authv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", xerrors.Errorf("unable to review the token: %s", err)
+	}
+
+	if !review.Status.Authenticated || len(review.Status.User.Username) == 0 {
+		return "", xerrors.Errorf("token is not authenticated: %s", review.Status.Error)
+	}
+
+	return review.Status.User.Username, nil
+}
+
+// recordHomeUser records the user in the app if the controller keeps user homes, so that the home is mounted in
+// Pods created later.
+func (t *terminalGate) recordHomeUser(ctx context.Context, name *types.NamespacedName, user string) error {
+	key := userKeyOf(user)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		apps := t.appClient.CliappV1().CliApps(name.Namespace)
+		app, err := apps.Get(ctx, name.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if len(app.Status.UserHomeDir) == 0 {
+			return nil
+		}
+
+		users := map[string]string{}
+		if value := app.Annotations[annoKeyHomeUsers]; len(value) > 0 {
+			if err = json.Unmarshal([]byte(value), &users); err != nil {
+				klog.Errorf("invalid annotation %s of app %s is overwritten: %s", annoKeyHomeUsers, name, err)
+				users = map[string]string{}
+			}
+		}
+
+		if lastSession, err := time.Parse(time.RFC3339, users[key]); err == nil &&
+			time.Since(lastSession) < homeUserRecordInterval {
+			return nil
+		}
+
+		users[key] = time.Now().UTC().Format(time.RFC3339)
+		value, err := json.Marshal(users)
+		if err != nil {
+			panic(err)
+		}
+
+		if app.Annotations == nil {
+			app.Annotations = map[string]string{}
+		}
+
+		app.Annotations[annoKeyHomeUsers] = string(value)
+		_, err = apps.Update(ctx, app, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// homeMounted checks whether the home of the user is mounted in the app Pod.
+func (t *terminalGate) homeMounted(ctx context.Context, app *appcorev1.CliApp, user string) bool {
+	if len(app.Status.PodName) == 0 {
+		return false
+	}
+
+	pod, err := t.clientset.CoreV1().Pods(app.Namespace).Get(ctx, app.Status.PodName, metav1.GetOptions{})
+	if err != nil {
+		klog.Errorf("unable to fetch Pod %s/%s: %s", app.Namespace, app.Status.PodName, err)
+		return false
+	}
+
+	key := userKeyOf(user)
+	for _, mounted := range strings.Split(pod.Annotations[annoKeyHomeUsers], ",") {
+		if mounted == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// homeOf returns the home of the user if the app Pod mounts it. Homes are only mounted when Pods are created,
+// so users new to the running Pod use the app home until the app restarts.
+func (t *terminalGate) homeOf(
+	ctx context.Context, progress *progressWriter, app *appcorev1.CliApp, user string,
+) string {
+	if t.homeMounted(ctx, app, user) {
+		return path.Join(app.Status.UserHomeDir, userKeyOf(user))
+	}
+
+	progress.WriteLn(fmt.Sprintf("the home of %s will be mounted once the app restarts. "+
+		"The session uses the app home", user))
+	return ""
+}
@@ -0,0 +1,55 @@
+package gate
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	rpc "github.com/warm-metal/cliapp/pkg/session"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// plaintextStream is a shell stream which sends the request without TLS.
+type plaintextStream struct {
+	grpc.ServerStream
+	req *rpc.StdIn
+}
+
+func (s *plaintextStream) Context() context.Context {
+	return peer.NewContext(context.TODO(), &peer.Peer{})
+}
+
+func (s *plaintextStream) Recv() (*rpc.StdIn, error) {
+	return s.req, nil
+}
+
+func (s *plaintextStream) Send(*rpc.StdOut) error {
+	return nil
+}
+
+var _ = Describe("Session users", func() {
+	It("should only accept tokens over TLS", func() {
+		Expect(overTLS(context.TODO())).To(BeFalse())
+		Expect(overTLS(peer.NewContext(context.TODO(), &peer.Peer{}))).To(BeFalse())
+		Expect(overTLS(peer.NewContext(context.TODO(), &peer.Peer{AuthInfo: credentials.TLSInfo{}}))).To(BeTrue())
+	})
+
+	It("should refuse tokens without TLS before opening sessions", func() {
+		gate := &terminalGate{sessionMap: map[types.NamespacedName]*appSession{}}
+		err := gate.OpenShell(&plaintextStream{req: &rpc.StdIn{
+			App:   &rpc.App{Name: "kubectl", Namespace: "default"},
+			Token: "token",
+		}})
+		Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+		Expect(gate.sessionMap).To(BeEmpty())
+	})
+
+	It("should hash user names to keys", func() {
+		Expect(userKeyOf("alice")).To(MatchRegexp(`^[0-9a-f]{32}$`))
+		Expect(userKeyOf("alice")).NotTo(Equal(userKeyOf("bob")))
+	})
+})
@@ -2,6 +2,7 @@ package libcli
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/moby/term"
 	appcorev1 "github.com/warm-metal/cliapp/pkg/apis/cliapp/v1"
@@ -10,6 +11,7 @@ import (
 	"golang.org/x/xerrors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/status"
 	"io"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -18,6 +20,7 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
 )
 
@@ -80,13 +83,65 @@ func fetchServiceEndpoints(
 }
 
 func ExecCliApp(ctx context.Context, endpoints []string, app *appcorev1.CliApp, args []string, stdin io.Reader, stdout io.Writer) error {
+	return ExecCliAppCommand(ctx, endpoints, app, "", args, stdin, stdout)
+}
+
+// CommandAliases returns aliases of the app in order. Clients install a shortcut for each of them.
+func CommandAliases(app *appcorev1.CliApp) []string {
+	aliases := make([]string, 0, len(app.Spec.Commands))
+	for alias := range app.Spec.Commands {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+	return aliases
+}
+
+// ExecCliAppCommand runs the command of the alias in Spec.Commands of the app, or Spec.Command if the alias is empty.
+func ExecCliAppCommand(
+	ctx context.Context, endpoints []string, app *appcorev1.CliApp, alias string, args []string, stdin io.Reader,
+	stdout io.Writer,
+) error {
+	return ExecCliAppWithOptions(ctx, endpoints, app, &ExecOptions{Alias: alias, Args: args}, stdin, stdout)
+}
+
+type ExecOptions struct {
+	// Alias in Spec.Commands of the app to run. Spec.Command is run if empty.
+	Alias string
+
+	// Arguments appended to the command.
+	Args []string
+
+	// Bearer token of the user. The gate keeps shell history of the user it authenticates.
+	// It is only sent over TLS.
+	Token string
+
+	// TLS configuration of connections to the gate. Connections are insecure if nil.
+	TLS *tls.Config
+
+	// Don't keep shell history of the session.
+	NoHistory bool
+}
+
+// ExecCliAppWithOptions runs a command of the app as ExecCliAppCommand does, with extra options.
+func ExecCliAppWithOptions(
+	ctx context.Context, endpoints []string, app *appcorev1.CliApp, opts *ExecOptions, stdin io.Reader,
+	stdout io.Writer,
+) error {
+	transport := grpc.WithInsecure()
+	if opts.TLS != nil {
+		transport = grpc.WithTransportCredentials(credentials.NewTLS(opts.TLS))
+	} else if len(opts.Token) > 0 {
+		return xerrors.Errorf("TLS is required to send the token")
+	}
+
 	var cc *grpc.ClientConn
 	for i, ep := range endpoints {
 		endpoint, err := url.Parse(ep)
 		if err != nil {
 			panic(err)
 		}
-		cc, err = grpc.DialContext(ctx, endpoint.Host, grpc.WithInsecure(), grpc.WithBlock())
+		cc, err = grpc.DialContext(ctx, endpoint.Host, transport, grpc.WithBlock())
 		if err == nil {
 			break
 		}
@@ -120,8 +175,11 @@ func ExecCliApp(ctx context.Context, endpoints []string, app *appcorev1.CliApp,
 			Name:      app.Name,
 			Namespace: app.Namespace,
 		},
-		Input:        args,
+		Input:        opts.Args,
 		TerminalSize: initTermSize,
+		Alias:        opts.Alias,
+		Token:        opts.Token,
+		NoHistory:    opts.NoHistory,
 	})
 
 	if err != nil {